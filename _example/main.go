@@ -9,30 +9,8 @@ import (
 )
 
 func main() {
-	serverErrorHandler := func(c *gin.Context, service string, err error) {
-		if err == nil {
-			return
-		}
-		if apiErr, ok := err.(errors.ApiError); ok {
-			c.AbortWithStatusJSON(apiErr.GetStatus(),
-				map[string]interface{}{
-					"status":   apiErr.GetStatus(),
-					"error":    apiErr.Error(),
-					"service":  service,
-					"errorKey": apiErr.GetKey(),
-				})
-		} else {
-			c.AbortWithStatusJSON(http.StatusInternalServerError,
-				map[string]interface{}{
-					"status":   http.StatusInternalServerError,
-					"title":    err.Error(),
-					"service":  service,
-					"errorKey": "",
-				})
-		}
-	}
 	apitool.NewGinApiServer("debug", "test").
-		SetServerErrorHandler(serverErrorHandler).
+		SetServerErrorHandler(errors.NewProblemErrorHandler()).
 		AddAPIs(
 			&testApiService{},
 		).Run(8080)
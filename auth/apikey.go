@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const apiKeyPrefix = "ak_"
+
+var ErrApiKeyNotFound = errors.New("api key not found")
+
+// ApiKey is a long-lived credential of a machine client, only the hash of the key is stored.
+type ApiKey struct {
+	ID      string   `json:"id"`
+	Hash    string   `json:"hash"`
+	UserID  string   `json:"userId"`
+	Account string   `json:"account"`
+	Name    string   `json:"name"`
+	Perms   []string `json:"perms"`
+	// ExpiresAt is the expiry of the key, zero never expires.
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+func (k *ApiKey) isExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// ApiKeyStore keeps the api keys, the implementations must be safe for concurrent use.
+type ApiKeyStore interface {
+	Save(key *ApiKey) error
+	// GetByHash returns ErrApiKeyNotFound if no key has the hash.
+	GetByHash(hash string) (*ApiKey, error)
+	Delete(id string) error
+	// Touch records the last used time of the key.
+	Touch(id string, at time.Time) error
+}
+
+// HashApiKey returns the hex sha256 of key, the keys are random so a fast hash is enough.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateApiKey generates a key for the ID, user and perms of key, then saves key with the hash.
+// The returned plain key is not stored, it can't be shown again.
+func CreateApiKey(store ApiKeyStore, key *ApiKey) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plain := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	if key.ID == "" {
+		id, err := newTokenID()
+		if err != nil {
+			return "", err
+		}
+		key.ID = id
+	}
+	key.Hash = HashApiKey(plain)
+	key.CreatedAt = time.Now()
+	if err := store.Save(key); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+func NewMemoryApiKeyStore() ApiKeyStore {
+	return &memoryApiKeyStore{keys: make(map[string]*ApiKey), ids: make(map[string]string)}
+}
+
+type memoryApiKeyStore struct {
+	lock sync.RWMutex
+	// keys by id, ids by hash
+	keys map[string]*ApiKey
+	ids  map[string]string
+}
+
+func (s *memoryApiKeyStore) Save(key *ApiKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if old, ok := s.keys[key.ID]; ok {
+		delete(s.ids, old.Hash)
+	}
+	k := *key
+	s.keys[key.ID] = &k
+	s.ids[key.Hash] = key.ID
+	return nil
+}
+
+func (s *memoryApiKeyStore) GetByHash(hash string) (*ApiKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key, ok := s.keys[s.ids[hash]]
+	if !ok {
+		return nil, ErrApiKeyNotFound
+	}
+	k := *key
+	return &k, nil
+}
+
+func (s *memoryApiKeyStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if key, ok := s.keys[id]; ok {
+		delete(s.ids, key.Hash)
+		delete(s.keys, id)
+	}
+	return nil
+}
+
+func (s *memoryApiKeyStore) Touch(id string, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrApiKeyNotFound
+	}
+	key.LastUsedAt = at
+	return nil
+}
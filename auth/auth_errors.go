@@ -0,0 +1,125 @@
+package auth
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strings"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderWWWAuthenticate = "WWW-Authenticate"
+
+	// RFC 6750 error codes
+	bearerErrInvalidRequest    = "invalid_request"
+	bearerErrInvalidToken      = "invalid_token"
+	bearerErrInsufficientScope = "insufficient_scope"
+)
+
+// AuthErrors are the errors returned by the auth middleware, nil fields use the default errors.
+type AuthErrors struct {
+	PathNotFound error
+	MissToken    error
+	InvalidToken error
+	HostNotMatch error
+	NoPerm       error
+}
+
+func defaultAuthErrors() AuthErrors {
+	return AuthErrors{
+		PathNotFound: errors.Error_Auth_Path_NotFound,
+		MissToken:    errors.Error_Auth_Miss_Token,
+		InvalidToken: errors.Error_Auth_Invalid_Token,
+		HostNotMatch: errors.Error_Auth_Host_Not_Match,
+		NoPerm:       errors.Error_Auth_No_Perm,
+	}
+}
+
+func (e AuthErrors) merge(override AuthErrors) AuthErrors {
+	if override.PathNotFound != nil {
+		e.PathNotFound = override.PathNotFound
+	}
+	if override.MissToken != nil {
+		e.MissToken = override.MissToken
+	}
+	if override.InvalidToken != nil {
+		e.InvalidToken = override.InvalidToken
+	}
+	if override.HostNotMatch != nil {
+		e.HostNotMatch = override.HostNotMatch
+	}
+	if override.NoPerm != nil {
+		e.NoPerm = override.NoPerm
+	}
+	return e
+}
+
+type BearAuthOption func(*bearAuthMiddle)
+
+// BearAuthWithErrors overrides the errors returned by the middleware.
+func BearAuthWithErrors(errs AuthErrors) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.errs = m.errs.merge(errs)
+	}
+}
+
+// BearAuthWithRealm sets the realm of the WWW-Authenticate header.
+func BearAuthWithRealm(realm string) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.realm = realm
+	}
+}
+
+func (m *bearAuthMiddle) abort(c *gin.Context, err error, bearerErr string) {
+	abortWithChallenge(c, m.GinApiErrorHandler, m.challenge, m.realm, err, bearerErr)
+}
+
+// abortWithChallenge writes the RFC 6750 style challenge of scheme for 401 and insufficient scope errors
+// and calls the error handler, an empty scheme writes no challenge.
+func abortWithChallenge(c *gin.Context, handler errors.GinApiErrorHandler, scheme, realm string, err error, bearerErr string) {
+	var apiErr errors.ApiError
+	status := 0
+	if stderrors.As(err, &apiErr) {
+		status = apiErr.GetStatus()
+	}
+	if scheme != "" && (status == http.StatusUnauthorized ||
+		(status == http.StatusForbidden && bearerErr == bearerErrInsufficientScope)) {
+		c.Header(HeaderWWWAuthenticate, authChallenge(scheme, realm, bearerErr, err.Error()))
+	}
+	handler(c, err)
+	c.Abort()
+}
+
+// loaderError maps the error of a reqUserLoader to the RFC 6750 error code and configured error.
+func (m *bearAuthMiddle) loaderError(err error) (string, error) {
+	switch {
+	case stderrors.Is(err, errors.Error_Auth_Miss_Token):
+		return "", m.errs.MissToken
+	case stderrors.Is(err, errors.Error_Auth_Invalid_Token):
+		return bearerErrInvalidToken, m.errs.InvalidToken
+	}
+	return bearerErrInvalidToken, err
+}
+
+func authChallenge(scheme, realm, bearerErr, desc string) string {
+	var params []string
+	if realm != "" {
+		params = append(params, `realm="`+quoteEscape(realm)+`"`)
+	}
+	if bearerErr != "" {
+		params = append(params, `error="`+bearerErr+`"`)
+		if desc != "" {
+			params = append(params, `error_description="`+quoteEscape(desc)+`"`)
+		}
+	}
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthzRequest holds the attributes of a request for the Authorizer.
+type AuthzRequest struct {
+	User   ReqUser
+	Path   string // the route path, e.g. /v1/users/:id
+	Method string
+	Params map[string]string
+	Query  url.Values
+	Header http.Header
+	Time   time.Time
+}
+
+type AuthzDecision struct {
+	Allow  bool
+	Policy string
+	Reason string
+}
+
+// Authorizer makes attribute based decisions, it's consulted by the auth middleware after HasPerm.
+type Authorizer interface {
+	Authorize(ctx context.Context, req *AuthzRequest) (AuthzDecision, error)
+}
+
+type AuthorizerFunc func(ctx context.Context, req *AuthzRequest) (AuthzDecision, error)
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, req *AuthzRequest) (AuthzDecision, error) {
+	return f(ctx, req)
+}
+
+// DecisionLogger records the decisions of the Authorizer for audits.
+type DecisionLogger interface {
+	LogDecision(req *AuthzRequest, decision AuthzDecision, err error)
+}
+
+// NewDecisionLogger writes a json line per decision to w.
+func NewDecisionLogger(w io.Writer) DecisionLogger {
+	return &jsonDecisionLogger{enc: json.NewEncoder(w)}
+}
+
+type jsonDecisionLogger struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+type decisionLog struct {
+	Time    time.Time `json:"time"`
+	UserID  string    `json:"userId"`
+	Account string    `json:"account"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Allow   bool      `json:"allow"`
+	Policy  string    `json:"policy,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (l *jsonDecisionLogger) LogDecision(req *AuthzRequest, decision AuthzDecision, err error) {
+	entry := decisionLog{
+		Time:   req.Time,
+		Method: req.Method,
+		Path:   req.Path,
+		Allow:  decision.Allow,
+		Policy: decision.Policy,
+		Reason: decision.Reason,
+	}
+	if req.User != nil {
+		entry.UserID = req.User.GetId()
+		entry.Account = req.User.GetAccount()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_ = l.enc.Encode(entry)
+}
+
+// BearAuthWithAuthorizer consults authorizer after the permission check, a deny returns the NoPerm error.
+func BearAuthWithAuthorizer(authorizer Authorizer) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.authorizer = authorizer
+	}
+}
+
+func BearAuthWithDecisionLogger(logger DecisionLogger) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.decisionLogger = logger
+	}
+}
+
+func NewAuthzRequest(c *gin.Context, user ReqUser) *AuthzRequest {
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	return &AuthzRequest{
+		User:   user,
+		Path:   c.FullPath(),
+		Method: c.Request.Method,
+		Params: params,
+		Query:  c.Request.URL.Query(),
+		Header: c.Request.Header,
+		Time:   time.Now(),
+	}
+}
+
+// authorize fails closed, an error of the authorizer is a deny.
+func (m *bearAuthMiddle) authorize(c *gin.Context, user ReqUser) bool {
+	req := NewAuthzRequest(c, user)
+	decision, err := m.authorizer.Authorize(c.Request.Context(), req)
+	if err != nil {
+		decision.Allow = false
+	}
+	if m.decisionLogger != nil {
+		m.decisionLogger.LogDecision(req, decision, err)
+	}
+	return decision.Allow
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"encoding/json"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const ClaimsKeyAudience = "aud"
+
+var (
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrTokenAudience    = errors.New("token audience not match")
+)
+
+// Audience is the aud claim, it's a string or an array of strings in json.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// RegisteredClaims are the RFC 7519 registered claims, embed it in a claims struct
+// to use IssueToken and ParseClaims, e.g.
+//
+//	type UserClaims struct {
+//		auth.RegisteredClaims
+//		Roles []string `json:"roles"`
+//	}
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Valid is a no-op, the claims are validated with leeway and audience by ParseClaims.
+func (c RegisteredClaims) Valid() error {
+	return nil
+}
+
+func (c *RegisteredClaims) GetRegisteredClaims() *RegisteredClaims {
+	return c
+}
+
+type RegisteredClaimer interface {
+	jwt.Claims
+	GetRegisteredClaims() *RegisteredClaims
+}
+
+type claimsPtr[T any] interface {
+	*T
+	RegisteredClaimer
+}
+
+func registeredClaimsFromMap(claims jwt.MapClaims) *RegisteredClaims {
+	return &RegisteredClaims{
+		Issuer:    getStrClaim(claims, ClaimsKeyIssuer),
+		Subject:   getStrClaim(claims, ClaimsKeySubject),
+		Audience:  getStrSliceClaim(claims, ClaimsKeyAudience),
+		ExpiresAt: getIntClaim(claims, "exp"),
+		NotBefore: getIntClaim(claims, "nbf"),
+		IssuedAt:  getIntClaim(claims, "iat"),
+		ID:        getStrClaim(claims, ClaimsKeyJwtID),
+	}
+}
+
+func getIntClaim(claims jwt.MapClaims, key string) int64 {
+	switch v := claims[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case json.Number:
+		i, _ := v.Int64()
+		return i
+	}
+	return 0
+}
+
+// audienceClaim is the aud value of a map claims.
+func audienceClaim(aud []string) interface{} {
+	if len(aud) == 1 {
+		return aud[0]
+	}
+	return aud
+}
+
+// claimsValidation validates the time claims with leeway for clock skew,
+// the token must have one of audience when it's not empty.
+type claimsValidation struct {
+	audience []string
+	leeway   time.Duration
+}
+
+type ParseOption func(*claimsValidation)
+
+// ParseWithAudience overrides the accepted audience.
+func ParseWithAudience(aud ...string) ParseOption {
+	return func(v *claimsValidation) {
+		v.audience = aud
+	}
+}
+
+// ParseWithLeeway overrides the clock skew allowed for exp, nbf and iat.
+func ParseWithLeeway(leeway time.Duration) ParseOption {
+	return func(v *claimsValidation) {
+		v.leeway = leeway
+	}
+}
+
+func (v claimsValidation) validate(c *RegisteredClaims, now time.Time) error {
+	if c.ExpiresAt != 0 && now.After(time.Unix(c.ExpiresAt, 0).Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(v.leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if c.IssuedAt != 0 && now.Add(v.leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if len(v.audience) == 0 {
+		return nil
+	}
+	for _, aud := range c.Audience {
+		if isStrInList(aud, v.audience...) {
+			return nil
+		}
+	}
+	return ErrTokenAudience
+}
+
+// claimsVerifier is implemented by the JwtToken supporting ParseClaims.
+type claimsVerifier interface {
+	keyFunc(token *jwt.Token) (interface{}, error)
+	claimsValidation() claimsValidation
+}
+
+// parseValidToken verifies the signature, then validates the registered claims.
+func parseValidToken(v claimsVerifier, tokenStr string, claims jwt.Claims, opts ...ParseOption) (*jwt.Token, error) {
+	token, err := parseTokenWithClaims(&jwt.Parser{SkipClaimsValidation: true}, tokenStr, claims, v.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	validation := v.claimsValidation()
+	for _, opt := range opts {
+		opt(&validation)
+	}
+	var rc *RegisteredClaims
+	switch c := token.Claims.(type) {
+	case jwt.MapClaims:
+		rc = registeredClaimsFromMap(c)
+	case RegisteredClaimer:
+		rc = c.GetRegisteredClaims()
+	default:
+		return nil, errors.New("invalid claims")
+	}
+	if err := validation.validate(rc, time.Now()); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ParseClaims verifies tokenStr with jt (JwtConf or the JwksConf verifier) and returns the typed claims, e.g.
+//
+//	claims, err := auth.ParseClaims[UserClaims](jwtConf, tokenStr)
+func ParseClaims[T any, PT claimsPtr[T]](jt JwtToken, tokenStr string, opts ...ParseOption) (*T, error) {
+	v, ok := jt.(claimsVerifier)
+	if !ok {
+		return nil, errors.Errorf("typed claims not supported by %T", jt)
+	}
+	claims := new(T)
+	if _, err := parseValidToken(v, tokenStr, PT(claims), opts...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IssueToken signs a copy of claims, the empty iat, exp, jti and aud are filled.
+// exp is now plus lifetime, a zero lifetime uses Claims.ExpDuration of JwtConf.
+func IssueToken[T any, PT claimsPtr[T]](j *JwtConf, claims T, lifetime time.Duration) (string, error) {
+	if j == nil {
+		return "", errors.New("jwtConf not set")
+	}
+	if lifetime <= 0 {
+		lifetime = j.accessTokenLifetime()
+	}
+	p := PT(&claims)
+	rc := p.GetRegisteredClaims()
+	now := time.Now()
+	if rc.IssuedAt == 0 {
+		rc.IssuedAt = now.Unix()
+	}
+	if rc.ExpiresAt == 0 {
+		rc.ExpiresAt = now.Add(lifetime).Unix()
+	}
+	if rc.ID == "" {
+		jti, err := newTokenID()
+		if err != nil {
+			return "", err
+		}
+		rc.ID = jti
+	}
+	if len(rc.Audience) == 0 {
+		rc.Audience = j.Claims.Audience
+	}
+	return j.signToken(p, nil)
+}
@@ -0,0 +1,115 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testUserClaims struct {
+	auth.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+func TestTypedClaims(t *testing.T) {
+	j := newTestJwtConf(t)
+	j.Claims.Audience = []string{"api"}
+
+	tokenStr, err := auth.IssueToken(j, testUserClaims{
+		RegisteredClaims: auth.RegisteredClaims{Issuer: "example.com", Subject: "u1"},
+		Roles:            []string{"admin"},
+	}, 5*time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := auth.ParseClaims[testUserClaims](j, tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", claims.Subject)
+	assert.Equal(t, auth.Audience{"api"}, claims.Audience)
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.NotEmpty(t, claims.ID)
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), claims.ExpiresAt, 2)
+
+	_, err = auth.ParseClaims[testUserClaims](j, tokenStr, auth.ParseWithAudience("other"))
+	assert.ErrorIs(t, err, auth.ErrTokenAudience)
+
+	// the map claims are validated too
+	token, err := j.ParseToken(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", token.Claims.(jwt.MapClaims)["sub"])
+	j.Claims.Audience = []string{"other"}
+	_, err = j.ParseToken(tokenStr)
+	assert.ErrorIs(t, err, auth.ErrTokenAudience)
+}
+
+func TestClaimsLeeway(t *testing.T) {
+	j := newTestJwtConf(t)
+	now := time.Now()
+	expired, err := auth.IssueToken(j, testUserClaims{RegisteredClaims: auth.RegisteredClaims{
+		IssuedAt:  now.Add(-time.Hour).Unix(),
+		ExpiresAt: now.Add(-10 * time.Second).Unix(),
+	}}, 0)
+	assert.NoError(t, err)
+	notBefore, err := auth.IssueToken(j, testUserClaims{RegisteredClaims: auth.RegisteredClaims{
+		NotBefore: now.Add(10 * time.Second).Unix(),
+	}}, 0)
+	assert.NoError(t, err)
+
+	_, err = auth.ParseClaims[testUserClaims](j, expired)
+	assert.ErrorIs(t, err, auth.ErrTokenExpired)
+	_, err = auth.ParseClaims[testUserClaims](j, notBefore)
+	assert.ErrorIs(t, err, auth.ErrTokenNotValidYet)
+
+	j.Claims.Leeway = time.Minute
+	_, err = auth.ParseClaims[testUserClaims](j, expired)
+	assert.NoError(t, err)
+	_, err = j.ParseToken(notBefore)
+	assert.NoError(t, err)
+}
+
+func TestGetTokenLifetime(t *testing.T) {
+	j := newTestJwtConf(t)
+	j.Claims.ExpDuration = 8 * time.Hour
+
+	data := map[string]interface{}{"sub": "u1"}
+	tokenStr, err := j.GetToken("example.com", data, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sub": "u1"}, data)
+	claims, err := auth.ParseClaims[testUserClaims](j, *tokenStr)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(8*time.Hour).Unix(), claims.ExpiresAt, 2)
+
+	tokenStr, err = j.GetTokenWithDuration("example.com", data, 24*time.Hour)
+	assert.NoError(t, err)
+	claims, err = auth.ParseClaims[testUserClaims](j, *tokenStr)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), claims.ExpiresAt, 2)
+
+	pair, err := j.GetTokenWithRefresh("example.com", data, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"sub": "u1"}, data)
+	tokenStr, err = j.RefreshAccessToken(pair.RefreshToken)
+	assert.NoError(t, err)
+	claims, err = auth.ParseClaims[testUserClaims](j, *tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", claims.Subject)
+	assert.InDelta(t, time.Now().Add(8*time.Hour).Unix(), claims.ExpiresAt, 2)
+}
+
+func TestAccessTokenAudience(t *testing.T) {
+	j := newTestJwtConf(t)
+	j.Claims.Audience = []string{"api"}
+	tokenStr, err := j.GetAccessToken("example.com", "order", 1, "db", "read")
+	assert.NoError(t, err)
+	token, err := j.ParseToken(*tokenStr)
+	assert.NoError(t, err)
+	scope, err := auth.NewAccessScopeFromToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "order", scope.Source)
+
+	j.Claims.Audience = []string{"other"}
+	_, err = j.ParseToken(*tokenStr)
+	assert.ErrorIs(t, err, auth.ErrTokenAudience)
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HmacScheme is the Authorization scheme of the signed requests:
+//
+//	Authorization: HMAC-SHA256 keyId="k1", ts="1700000000", nonce="...", headers="content-type", signature="..."
+//
+// The signature is the base64 HMAC-SHA256 of the lines of method, request uri, host, ts, nonce,
+// "name:value" of each signed header and the hex sha256 of the body.
+const HmacScheme = "HMAC-SHA256"
+
+var ErrHmacKeyNotFound = errors.New("hmac key not found")
+
+// HmacKey is the shared secret of a caller, the request signed by it is authenticated as the user of the key.
+type HmacKey struct {
+	ID      string
+	Secret  []byte
+	UserID  string
+	Account string
+	Name    string
+	Perms   []string
+}
+
+type HmacKeyStore interface {
+	// GetHmacKey returns ErrHmacKeyNotFound if id is unknown.
+	GetHmacKey(id string) (*HmacKey, error)
+}
+
+func NewMemoryHmacKeyStore(keys ...HmacKey) HmacKeyStore {
+	s := make(memoryHmacKeyStore, len(keys))
+	for _, k := range keys {
+		s[k.ID] = k
+	}
+	return s
+}
+
+type memoryHmacKeyStore map[string]HmacKey
+
+func (s memoryHmacKeyStore) GetHmacKey(id string) (*HmacKey, error) {
+	k, ok := s[id]
+	if !ok {
+		return nil, ErrHmacKeyNotFound
+	}
+	return &k, nil
+}
+
+// NonceStore rejects the replayed nonces, implement it with a shared backend when the service runs more than one instance.
+type NonceStore interface {
+	// Use records nonce until exp, it returns false if nonce is already used.
+	Use(nonce string, exp time.Time) (bool, error)
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{used: make(map[string]time.Time)}
+}
+
+type memoryNonceStore struct {
+	lock      sync.Mutex
+	used      map[string]time.Time
+	lastPrune time.Time
+}
+
+func (s *memoryNonceStore) Use(nonce string, exp time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPrune) > revocationPruneInterval {
+		for n, e := range s.used {
+			if !now.Before(e) {
+				delete(s.used, n)
+			}
+		}
+		s.lastPrune = now
+	}
+	if e, ok := s.used[nonce]; ok && now.Before(e) {
+		return false, nil
+	}
+	s.used[nonce] = exp
+	return true, nil
+}
+
+type hmacParams struct {
+	keyID     string
+	ts        string
+	nonce     string
+	headers   []string
+	signature string
+}
+
+func (p *hmacParams) String() string {
+	return HmacScheme + ` keyId="` + p.keyID + `", ts="` + p.ts + `", nonce="` + p.nonce +
+		`", headers="` + strings.Join(p.headers, ";") + `", signature="` + p.signature + `"`
+}
+
+func parseHmacParams(s string) (*hmacParams, error) {
+	p := &hmacParams{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, errors.New("invalid hmac authorization")
+		}
+		v = strings.Trim(v, `"`)
+		switch k {
+		case "keyId":
+			p.keyID = v
+		case "ts":
+			p.ts = v
+		case "nonce":
+			p.nonce = v
+		case "headers":
+			if v != "" {
+				p.headers = strings.Split(v, ";")
+			}
+		case "signature":
+			p.signature = v
+		}
+	}
+	if p.keyID == "" || p.ts == "" || p.nonce == "" || p.signature == "" {
+		return nil, errors.New("invalid hmac authorization")
+	}
+	return p, nil
+}
+
+func hmacStringToSign(method, uri, host string, header http.Header, p *hmacParams, body []byte) string {
+	var sb strings.Builder
+	for _, line := range []string{method, uri, host, p.ts, p.nonce} {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	for _, h := range p.headers {
+		sb.WriteString(strings.ToLower(h) + ":" + strings.TrimSpace(header.Get(h)) + "\n")
+	}
+	sum := sha256.Sum256(body)
+	sb.WriteString(hex.EncodeToString(sum[:]))
+	return sb.String()
+}
+
+func hmacSign(secret []byte, s string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HmacSigner signs the requests with the HmacScheme.
+type HmacSigner struct {
+	KeyID  string
+	Secret []byte
+	// Headers are the extra signed headers, e.g. content-type.
+	Headers []string
+}
+
+// Sign sets the Authorization header of req, the body is read and restored.
+func (s *HmacSigner) Sign(req *http.Request) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	nonce, err := newTokenID()
+	if err != nil {
+		return err
+	}
+	p := &hmacParams{
+		keyID:   s.KeyID,
+		ts:      strconv.FormatInt(time.Now().Unix(), 10),
+		nonce:   nonce,
+		headers: s.Headers,
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	p.signature = hmacSign(s.Secret, hmacStringToSign(req.Method, req.URL.RequestURI(), host, req.Header, p, body))
+	req.Header.Set(BearerAuthTokenKey, p.String())
+	return nil
+}
+
+// NewHmacRoundTripper signs every request with signer before next, a nil next is http.DefaultTransport.
+func NewHmacRoundTripper(signer *HmacSigner, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &hmacRoundTripper{signer: signer, next: next}
+}
+
+type hmacRoundTripper struct {
+	signer *HmacSigner
+	next   http.RoundTripper
+}
+
+func (t *hmacRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+func hmacEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	introspectionPruneInterval  = time.Minute
+	defaultIntrospectionTimeout = 10 * time.Second
+	maxIntrospectionSize        = 1 << 20
+)
+
+// defaultIntrospectionClient is used without IntrospectionConf.HttpClient, so a hung server can't block the requests forever.
+var defaultIntrospectionClient = &http.Client{Timeout: defaultIntrospectionTimeout}
+
+// IntrospectionResult is the RFC 7662 introspection response of a token.
+type IntrospectionResult struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Scopes returns the space separated scope as a list.
+func (r *IntrospectionResult) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// isActive also checks exp and nbf, so a stale answer of the server isn't trusted.
+func (r *IntrospectionResult) isActive(now time.Time) bool {
+	if !r.Active {
+		return false
+	}
+	if r.ExpiresAt != 0 && !now.Before(time.Unix(r.ExpiresAt, 0)) {
+		return false
+	}
+	return r.NotBefore == 0 || !now.Before(time.Unix(r.NotBefore, 0))
+}
+
+// TokenIntrospector resolves an opaque token to its introspection result.
+type TokenIntrospector interface {
+	// Introspect returns an error if the server can't answer, an inactive token is not an error.
+	Introspect(ctx context.Context, token string) (*IntrospectionResult, error)
+}
+
+// IntrospectionConf is the RFC 7662 introspection endpoint of an OAuth2 authorization server.
+type IntrospectionConf struct {
+	URL string `yaml:"url"`
+	// ClientID and ClientSecret authenticate this service to the endpoint by basic auth.
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// CacheTTL caps how long an active result is cached, the result is never cached beyond its exp.
+	// The results without exp are cached only when it's set.
+	CacheTTL   time.Duration `yaml:"cache_ttl"`
+	HttpClient *http.Client  `yaml:"-"`
+}
+
+// NewTokenIntrospector calls the endpoint of conf and caches the active results,
+// the inactive results are not cached. The tokens are cached by their sha256.
+func NewTokenIntrospector(conf IntrospectionConf) TokenIntrospector {
+	return &introspector{conf: conf, cache: make(map[string]introspectionEntry)}
+}
+
+type introspectionEntry struct {
+	result *IntrospectionResult
+	until  time.Time
+}
+
+type introspector struct {
+	conf      IntrospectionConf
+	lock      sync.Mutex
+	cache     map[string]introspectionEntry
+	lastPrune time.Time
+}
+
+func (i *introspector) httpClient() *http.Client {
+	if i.conf.HttpClient != nil {
+		return i.conf.HttpClient
+	}
+	return defaultIntrospectionClient
+}
+
+func (i *introspector) Introspect(ctx context.Context, token string) (*IntrospectionResult, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if result, ok := i.getCache(key); ok {
+		return result, nil
+	}
+	result, err := i.request(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !result.isActive(time.Now()) {
+		return &IntrospectionResult{Active: false}, nil
+	}
+	i.setCache(key, result)
+	return result, nil
+}
+
+func (i *introspector) request(ctx context.Context, token string) (*IntrospectionResult, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.conf.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.conf.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.conf.ClientID), url.QueryEscape(i.conf.ClientSecret))
+	}
+	resp, err := i.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("introspect token fail: status %d", resp.StatusCode)
+	}
+	var result IntrospectionResult
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionSize)).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode introspection response fail")
+	}
+	return &result, nil
+}
+
+func (i *introspector) getCache(key string) (*IntrospectionResult, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	e, ok := i.cache[key]
+	if !ok || !time.Now().Before(e.until) {
+		return nil, false
+	}
+	return e.result, true
+}
+
+func (i *introspector) setCache(key string, result *IntrospectionResult) {
+	now := time.Now()
+	var until time.Time
+	if result.ExpiresAt != 0 {
+		until = time.Unix(result.ExpiresAt, 0)
+	}
+	if ttl := i.conf.CacheTTL; ttl > 0 && (until.IsZero() || now.Add(ttl).Before(until)) {
+		until = now.Add(ttl)
+	}
+	if until.IsZero() {
+		return
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if now.Sub(i.lastPrune) > introspectionPruneInterval {
+		for k, e := range i.cache {
+			if !now.Before(e.until) {
+				delete(i.cache, k)
+			}
+		}
+		i.lastPrune = now
+	}
+	i.cache[key] = introspectionEntry{result: result, until: until}
+}
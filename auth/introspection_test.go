@@ -0,0 +1,153 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIntrospectionServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "api" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "access_token", r.PostFormValue("token_type_hint"))
+		exp := time.Now().Add(time.Hour).Unix()
+		var resp map[string]interface{}
+		switch r.PostFormValue("token") {
+		case "good":
+			resp = map[string]interface{}{
+				"active": true, "sub": "u1", "username": "alice", "scope": "report:read report:write",
+				"jti": "t1", "exp": exp,
+			}
+		case "expired":
+			resp = map[string]interface{}{"active": true, "sub": "u1", "exp": time.Now().Add(-time.Minute).Unix()}
+		case "boom":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "garbage":
+			w.Write([]byte("not json"))
+			return
+		default:
+			resp = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestTokenIntrospector(t *testing.T) {
+	var calls int32
+	srv := newTestIntrospectionServer(t, &calls)
+	defer srv.Close()
+	i := auth.NewTokenIntrospector(auth.IntrospectionConf{URL: srv.URL, ClientID: "api", ClientSecret: "secret"})
+	ctx := context.Background()
+
+	result, err := i.Introspect(ctx, "good")
+	assert.NoError(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, []string{"report:read", "report:write"}, result.Scopes())
+	_, err = i.Introspect(ctx, "good")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "active result is cached")
+
+	for _, token := range []string{"unknown", "expired"} {
+		result, err = i.Introspect(ctx, token)
+		assert.NoError(t, err)
+		assert.False(t, result.Active, token)
+	}
+	_, err = i.Introspect(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls), "inactive result is not cached")
+
+	for _, token := range []string{"boom", "garbage"} {
+		_, err = i.Introspect(ctx, token)
+		assert.Error(t, err, token)
+	}
+
+	bad := auth.NewTokenIntrospector(auth.IntrospectionConf{URL: srv.URL, ClientID: "api", ClientSecret: "wrong"})
+	_, err = bad.Introspect(ctx, "good")
+	assert.Error(t, err)
+
+	ttl := auth.NewTokenIntrospector(auth.IntrospectionConf{
+		URL: srv.URL, ClientID: "api", ClientSecret: "secret", CacheTTL: time.Millisecond,
+	})
+	atomic.StoreInt32(&calls, 0)
+	_, err = ttl.Introspect(ctx, "good")
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = ttl.Introspect(ctx, "good")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "cache is capped by CacheTTL")
+}
+
+func TestTokenIntrospectorBodyLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active":true,"sub":"u1","pad":"`))
+		w.Write([]byte(strings.Repeat("a", 2<<20)))
+		w.Write([]byte(`"}`))
+	}))
+	defer server.Close()
+
+	_, err := auth.NewTokenIntrospector(auth.IntrospectionConf{URL: server.URL}).Introspect(context.Background(), "good")
+	assert.Error(t, err)
+}
+
+func TestGinIntrospectionAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls int32
+	srv := newTestIntrospectionServer(t, &calls)
+	defer srv.Close()
+	m := auth.NewGinIntrospectionAuthMid(auth.NewTokenIntrospector(auth.IntrospectionConf{
+		URL: srv.URL, ClientID: "api", ClientSecret: "secret",
+	}))
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/reports", http.MethodGet, true, []auth.ApiPerm{"report:read"})
+	m.AddAuthPath("/admin", http.MethodGet, true, []auth.ApiPerm{"admin"})
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		u := auth.GetReqUserFromGin(c)
+		c.String(http.StatusOK, u.GetId()+":"+u.GetAccount()+":"+auth.GetAuthScheme(u))
+	}
+	r.GET("/reports", m.Handler(), handler)
+	r.GET("/admin", m.Handler(), handler)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		statusCode int
+		body       string
+	}{
+		{name: "active", path: "/reports", token: "good", statusCode: http.StatusOK, body: "u1:alice:introspection"},
+		{name: "no scope", path: "/admin", token: "good", statusCode: http.StatusForbidden},
+		{name: "inactive", path: "/reports", token: "unknown", statusCode: http.StatusUnauthorized},
+		{name: "server error fails closed", path: "/reports", token: "boom", statusCode: http.StatusUnauthorized},
+		{name: "miss token", path: "/reports", statusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
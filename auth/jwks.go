@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	JwksPath          = "/.well-known/jwks.json"
+	DefaultJwksMaxAge = time.Hour
+)
+
+// JWK is a RFC 7517 json web key, only the public parameters are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey returns the public key of the JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 {
+			return nil, errors.New("invalid rsa jwk")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		return decodeJwkEcPublicKey(k)
+	case "OKP":
+		return decodeJwkOkpPublicKey(k)
+	}
+	return nil, errors.Errorf("unsupported jwk kty [%s]", k.Kty)
+}
+
+// JwksProvider provides the public keys to verify the issued tokens.
+type JwksProvider interface {
+	GetJWKS() (*JWKS, error)
+}
+
+// NewRsaJWK converts an RSA public key to a JWK.
+func NewRsaJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// GetJWKS returns the signing public key with Header.Kid and the verify keys not retired.
+func (j *JwtConf) GetJWKS() (*JWKS, error) {
+	pk, err := j.getPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := NewJWK(j.GetKid(), pk)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &JWKS{Keys: []JWK{jwk}}
+	now := time.Now()
+	for _, k := range j.getActiveVerifyKeys(now) {
+		vpk, _, err := j.getVerifyKey(k.Kid, now)
+		if err != nil {
+			return nil, err
+		}
+		jwk, err := NewJWK(k.Kid, vpk)
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
+
+// NewJwksGinHandler serves the JWKS of provider with Cache-Control max-age and ETag.
+func NewJwksGinHandler(provider JwksProvider, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jwks, err := provider.GetJWKS()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		data, err := json.Marshal(jwks)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		c.Header("ETag", etag)
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", data)
+	}
+}
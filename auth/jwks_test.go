@@ -0,0 +1,55 @@
+package auth_test
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJwksGinHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+
+	r := gin.New()
+	r.GET(auth.JwksPath, auth.NewJwksGinHandler(j, 10*time.Minute))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, auth.JwksPath, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=600", w.Header().Get("Cache-Control"))
+
+	var jwks auth.JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 1)
+	key := jwks.Keys[0]
+	assert.Equal(t, "test-kid", key.Kid)
+	assert.Equal(t, "RS256", key.Alg)
+
+	// the published key verifies the issued token
+	n, _ := base64.RawURLEncoding.DecodeString(key.N)
+	e, _ := base64.RawURLEncoding.DecodeString(key.E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	tokenStr, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	token, err := jwt.Parse(*tokenStr, func(token *jwt.Token) (interface{}, error) { return pub, nil })
+	assert.NoError(t, err)
+	assert.True(t, token.Valid)
+
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	w = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", etag)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
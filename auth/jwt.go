@@ -3,16 +3,19 @@ package auth
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/hex"
 	"io"
 	"os"
+	"sync"
 	"time"
 
+	apierrors "github.com/94peter/api-toolkit/errors"
 	"github.com/pkg/errors"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -26,6 +29,12 @@ type JwtToken interface {
 	// 對特定資源存取金鑰
 	GetAccessToken(host string, source string, id interface{}, db string, perm ApiPerm) (*string, error)
 	RefreshAccessToken(refreshToken string) (*string, error)
+	// GetTokenWithDuration is GetToken with a lifetime not limited to 180 minutes.
+	GetTokenWithDuration(host string, data map[string]interface{}, lifetime time.Duration) (*string, error)
+	// RotateRefreshToken exchanges a refresh token for a new token pair, the old refresh token can't be used again.
+	RotateRefreshToken(refreshToken string) (*Token, error)
+	// RevokeRefreshToken revokes the family of a refresh token, e.g. on logout.
+	RevokeRefreshToken(refreshToken string) error
 }
 
 type JwtDI interface {
@@ -34,19 +43,36 @@ type JwtDI interface {
 }
 
 type JwtConf struct {
+	// Algorithm is one of RS256 (default), ES256, ES384 and EdDSA, only tokens of it are accepted.
+	Algorithm      string `yaml:"alg"`
 	PrivateKeyFile string `yaml:"privatekey"`
 	PublicKeyFile  string `yaml:"publickey"`
 	Header         struct {
 		Kid string `yaml:"kid"`
 	} `yaml:"header"`
 	Claims struct {
+		// ExpDuration is the default lifetime of the access tokens, the default is 60 minutes.
 		ExpDuration time.Duration `yaml:"exp"`
+		// Audience is the aud of the issued tokens, a parsed token must have one of them.
+		Audience []string `yaml:"aud"`
+		// Leeway is the clock skew allowed for exp, nbf and iat on parse.
+		Leeway time.Duration `yaml:"leeway"`
+		// AccessExpDuration is the lifetime of the tokens of GetAccessToken, the default is 24 hours.
+		AccessExpDuration time.Duration `yaml:"access_exp"`
 	} `yaml:"claims"`
 	RefreshSecret string `yaml:"refresh_secret"`
-
-	myHeader   map[string]interface{}
-	publicKey  *rsa.PublicKey
-	privateKey *rsa.PrivateKey
+	// VerifyKeys are the rotated keys, they only verify tokens until RetireAt.
+	VerifyKeys []VerifyKey `yaml:"verify_keys"`
+	// RefreshStore tracks the issued refresh tokens for rotation and revocation,
+	// without it the refresh tokens are stateless.
+	RefreshStore RefreshTokenStore `yaml:"-"`
+	// Revocations rejects the revoked tokens of GetAccessToken in NewGinAccessTokenMid.
+	Revocations RevocationStore `yaml:"-"`
+
+	lock       sync.RWMutex
+	publicKey  crypto.PublicKey
+	privateKey crypto.PrivateKey
+	verifyPKs  map[string]crypto.PublicKey
 }
 
 func (j *JwtConf) IsRsaKeysExist() bool {
@@ -64,42 +90,67 @@ func (j *JwtConf) GenerateRsaKeys(bitsize int) error {
 	return GenerateRsaKeys(bitsize, j.PrivateKeyFile, j.PublicKeyFile)
 }
 
+// GenerateKeys generates the key pair of Algorithm, bitsize is only used by RS256.
+func (j *JwtConf) GenerateKeys(bitsize int) error {
+	return GenerateKeys(j.Algorithm, bitsize, j.PrivateKeyFile, j.PublicKeyFile)
+}
+
+func (j *JwtConf) getSigningMethod() (jwt.SigningMethod, error) {
+	return getSigningMethod(j.Algorithm)
+}
+
 func (j *JwtConf) getHeader() map[string]interface{} {
-	if j.myHeader != nil {
-		delete(j.myHeader, "usa")
-		return j.myHeader
+	return map[string]interface{}{
+		"kid": j.GetKid(),
 	}
-	j.myHeader = map[string]interface{}{
-		"kid": j.Header.Kid,
+}
+
+// newTokenID returns a random id for the jti claim.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return j.myHeader
+	return hex.EncodeToString(b), nil
 }
 
-func (j *JwtConf) getPublicKey() (*rsa.PublicKey, error) {
-	if j.publicKey != nil {
-		return j.publicKey, nil
+func (j *JwtConf) getPublicKey() (crypto.PublicKey, error) {
+	j.lock.RLock()
+	pk := j.publicKey
+	j.lock.RUnlock()
+	if pk != nil {
+		return pk, nil
 	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
 	publicData, err := os.ReadFile(j.PublicKeyFile)
 	if err != nil {
 		return nil, err
 	}
-	j.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicData)
+	j.publicKey, err = parsePublicKeyFromPEM(publicData)
 	return j.publicKey, err
 }
 
-func (j *JwtConf) getPrivateKey() (*rsa.PrivateKey, error) {
-	if j.privateKey != nil {
-		return j.privateKey, nil
+func (j *JwtConf) getPrivateKey() (crypto.PrivateKey, error) {
+	j.lock.RLock()
+	pk := j.privateKey
+	j.lock.RUnlock()
+	if pk != nil {
+		return pk, nil
 	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
 	privateData, err := os.ReadFile(j.PrivateKeyFile)
 	if err != nil {
 		return nil, err
 	}
-	j.privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(privateData)
+	j.privateKey, err = parsePrivateKeyFromPEM(privateData)
 	return j.privateKey, err
 }
 
 func (j *JwtConf) GetKid() string {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
 	return j.Header.Kid
 }
 
@@ -107,95 +158,137 @@ func (j *JwtConf) NewJwt() JwtToken {
 	return j
 }
 
-func (j *JwtConf) ParseTokenUnValidate(tokenStr string) (*jwt.Token, error) {
-	if j == nil {
-		return nil, errors.New("jwtConf is nil")
+// keyFunc selects the signing key or a verify key by the kid header,
+// the token must use the algorithm of the selected key.
+func (j *JwtConf) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" || kid == j.GetKid() {
+		if err := checkAlg(token, j.Algorithm); err != nil {
+			return nil, err
+		}
+		return j.getPublicKey()
 	}
-	parser := jwt.Parser{
-		SkipClaimsValidation: true,
+	pk, alg, err := j.getVerifyKey(kid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlg(token, alg); err != nil {
+		return nil, err
 	}
+	return pk, nil
+}
 
-	token, err := parser.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		pk, err := j.getPublicKey()
-		return pk, err
-	})
-	if token == nil {
-		return nil, errors.New("token is nil")
-	}
-	if token.Valid {
-		return token, nil
-	} else if ve, ok := err.(*jwt.ValidationError); ok {
-		if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-			return nil, errors.New("That's not even a token")
-		} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-			// Token is either expired or not active yet
-			return nil, errors.New("Timing is everything")
-		} else {
-			return nil, err
-		}
+func (j *JwtConf) ParseTokenUnValidate(tokenStr string) (*jwt.Token, error) {
+	if j == nil {
+		return nil, errors.New("jwtConf is nil")
 	}
-	return nil, err
+	return parseTokenWithParser(&jwt.Parser{SkipClaimsValidation: true}, tokenStr, j.keyFunc)
 }
+
 func (j *JwtConf) ParseToken(tokenStr string) (*jwt.Token, error) {
 	if j == nil {
 		return nil, errors.New("jwtConf is nil")
 	}
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		pk, err := j.getPublicKey()
-		return pk, err
-	})
-	if token == nil {
-		return nil, errors.New("token is nil")
-	}
-	if token.Valid {
-		return token, nil
-	} else if ve, ok := err.(*jwt.ValidationError); ok {
-		if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-			return nil, errors.New("That's not even a token")
-		} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-			// Token is either expired or not active yet
-			return nil, errors.New("Timing is everything")
-		} else {
-			return nil, err
-		}
+	return parseValidToken(j, tokenStr, jwt.MapClaims{})
+}
+
+func (j *JwtConf) claimsValidation() claimsValidation {
+	return claimsValidation{audience: j.Claims.Audience, leeway: j.Claims.Leeway}
+}
+
+const (
+	defaultAccessTokenLifetime   = 60 * time.Minute
+	defaultResourceTokenLifetime = 24 * time.Hour
+)
+
+func (j *JwtConf) accessTokenLifetime() time.Duration {
+	if j.Claims.ExpDuration > 0 {
+		return j.Claims.ExpDuration
+	}
+	return defaultAccessTokenLifetime
+}
+
+func (j *JwtConf) resourceTokenLifetime() time.Duration {
+	if j.Claims.AccessExpDuration > 0 {
+		return j.Claims.AccessExpDuration
 	}
-	return nil, err
+	return defaultResourceTokenLifetime
 }
 
+// GetToken signs data with iss, iat, jti and exp claims, data is not modified.
+// exp is the lifetime in minutes up to 180, 0 uses Claims.ExpDuration.
 func (j *JwtConf) GetToken(host string, data map[string]interface{}, exp uint8) (*string, error) {
+	if j == nil {
+		return nil, errors.New("jwtConf not set")
+	}
+	if exp > 180 {
+		exp = 180
+	}
+	lifetime := j.accessTokenLifetime()
+	if exp > 0 {
+		lifetime = time.Duration(exp) * time.Minute
+	}
+	return j.GetTokenWithDuration(host, data, lifetime)
+}
+
+// GetTokenWithDuration signs data with a lifetime, a zero lifetime uses Claims.ExpDuration.
+// The aud claim is Claims.Audience when data has no aud.
+func (j *JwtConf) GetTokenWithDuration(host string, data map[string]interface{}, lifetime time.Duration) (*string, error) {
 	if j == nil {
 		return nil, errors.New("jwtConf not set")
 	}
 	if data == nil {
 		return nil, errors.New("no data")
 	}
-	if exp <= 0 {
-		exp = 60
-	} else if exp > 180 {
-		exp = 180
+	if lifetime <= 0 {
+		lifetime = j.accessTokenLifetime()
 	}
-
+	jti, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	claims := copyClaims(data)
 	now := time.Now()
-	data["iss"] = host
-	data["iat"] = now.Unix()
-	if exp > 0 {
-		data["exp"] = now.Add(time.Duration(exp) * time.Minute).Unix()
+	claims["iss"] = host
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+	claims[ClaimsKeyJwtID] = jti
+	if _, ok := claims[ClaimsKeyAudience]; !ok && len(j.Claims.Audience) > 0 {
+		claims[ClaimsKeyAudience] = audienceClaim(j.Claims.Audience)
+	}
+	ss, err := j.signToken(claims, nil)
+	if err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(data))
+	return &ss, nil
+}
 
+// signToken signs claims with the kid header and the extra header.
+func (j *JwtConf) signToken(claims jwt.Claims, header map[string]interface{}) (string, error) {
+	method, err := j.getSigningMethod()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
 	for k, v := range j.getHeader() {
 		token.Header[k] = v
 	}
-
+	for k, v := range header {
+		token.Header[k] = v
+	}
 	pk, err := j.getPrivateKey()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	ss, err := token.SignedString(pk)
-	if err != nil {
-		return nil, err
+	return token.SignedString(pk)
+}
+
+func copyClaims(data map[string]interface{}) jwt.MapClaims {
+	claims := make(jwt.MapClaims, len(data)+4)
+	for k, v := range data {
+		claims[k] = v
 	}
-	return &ss, nil
+	return claims
 }
 
 func (j *JwtConf) GetTokenWithRefresh(host string, data map[string]interface{}, exp uint8) (*Token, error) {
@@ -208,13 +301,25 @@ func (j *JwtConf) GetTokenWithRefresh(host string, data map[string]interface{},
 		return nil, err
 	}
 
+	data = copyClaims(data)
+	rec, err := j.newRefreshTokenRecord(data, "")
+	if err != nil {
+		return nil, err
+	}
 	refreshToken, err := j.createRefreshToken(host, data)
 	if err != nil {
 		return nil, err
 	}
+	if rec != nil {
+		if err := j.RefreshStore.Save(rec); err != nil {
+			return nil, err
+		}
+	}
 	return &Token{AccessToken: *t, RefreshToken: refreshToken}, nil
 }
 
+// RefreshAccessToken issues an access token by the refresh token, the refresh token is not rotated.
+// With RefreshStore, a revoked or rotated refresh token is rejected.
 func (j *JwtConf) RefreshAccessToken(refreshToken string) (*string, error) {
 	if j == nil {
 		return nil, errors.New("jwtConf not set")
@@ -223,30 +328,152 @@ func (j *JwtConf) RefreshAccessToken(refreshToken string) (*string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return j.GetToken(host, data, 60)
+	id, _ := popRefreshTokenID(data)
+	if j.RefreshStore != nil {
+		if err := j.checkRefreshToken(id); err != nil {
+			return nil, err
+		}
+	}
+	return j.GetTokenWithDuration(host, data, 0)
 }
 
-func (j *JwtConf) GetAccessToken(host string, source string, id interface{}, db string, perm ApiPerm) (*string, error) {
+func (j *JwtConf) RotateRefreshToken(refreshToken string) (*Token, error) {
 	if j == nil {
 		return nil, errors.New("jwtConf not set")
 	}
+	if j.RefreshStore == nil {
+		return nil, errors.New("refresh store not set")
+	}
+	host, data, err := j.pareserRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	id, family := popRefreshTokenID(data)
+	if id == "" {
+		return nil, ErrRefreshTokenNotFound
+	}
+	t, err := j.GetTokenWithDuration(host, data, 0)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := j.newRefreshTokenRecord(data, family)
+	if err != nil {
+		return nil, err
+	}
+	newRefreshToken, err := j.createRefreshToken(host, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.RefreshStore.Rotate(id, rec); err != nil {
+		return nil, err
+	}
+	return &Token{AccessToken: *t, RefreshToken: newRefreshToken}, nil
+}
+
+func (j *JwtConf) RevokeRefreshToken(refreshToken string) error {
+	if j == nil {
+		return errors.New("jwtConf not set")
+	}
+	if j.RefreshStore == nil {
+		return errors.New("refresh store not set")
+	}
+	_, data, err := j.pareserRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	_, family := popRefreshTokenID(data)
+	if family == "" {
+		return ErrRefreshTokenNotFound
+	}
+	return j.RefreshStore.RevokeFamily(family)
+}
+
+// checkRefreshToken rejects a revoked token, a rotated token is a reuse and revokes its family.
+func (j *JwtConf) checkRefreshToken(id string) error {
+	if id == "" {
+		return ErrRefreshTokenNotFound
+	}
+	rec, err := j.RefreshStore.Get(id)
+	if err != nil {
+		return err
+	}
+	if rec.Revoked {
+		return ErrRefreshTokenRevoked
+	}
+	if rec.RotatedTo != "" {
+		if err := j.RefreshStore.RevokeFamily(rec.Family); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(map[string]interface{}{
-		"iss":      host,
-		"source":   source,
-		"sourceId": id,
-		"db":       db,
-		"per":      perm,
-	}))
+// newRefreshTokenRecord adds the id and family claims of a new record to data,
+// it returns nil without RefreshStore. An empty family starts a new family.
+func (j *JwtConf) newRefreshTokenRecord(data map[string]any, family string) (*RefreshTokenRecord, error) {
+	if j.RefreshStore == nil {
+		return nil, nil
+	}
+	id, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		family = id
+	}
+	now := time.Now()
+	data[refreshClaimsKeyID] = id
+	data[refreshClaimsKeyFamily] = family
+	return &RefreshTokenRecord{
+		ID:        id,
+		Family:    family,
+		Subject:   getStrClaim(data, ClaimsKeySubject),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenDuration),
+	}, nil
+}
 
-	token.Header = j.getHeader()
-	token.Header["usa"] = "access"
+const (
+	refreshClaimsKeyID     = ClaimsKeyJwtID
+	refreshClaimsKeyFamily = "fam"
+	refreshTokenDuration   = 24 * time.Hour
+)
 
-	pk, err := j.getPrivateKey()
+// popRefreshTokenID removes the id and family claims from data.
+func popRefreshTokenID(data map[string]any) (id, family string) {
+	id = getStrClaim(data, refreshClaimsKeyID)
+	family = getStrClaim(data, refreshClaimsKeyFamily)
+	delete(data, refreshClaimsKeyID)
+	delete(data, refreshClaimsKeyFamily)
+	return
+}
+
+// GetAccessToken signs a token granting perm on the resource of source and id, e.g. a shared link.
+// It expires after Claims.AccessExpDuration and is revoked by RevokeToken with Revocations.
+func (j *JwtConf) GetAccessToken(host string, source string, id interface{}, db string, perm ApiPerm) (*string, error) {
+	if j == nil {
+		return nil, errors.New("jwtConf not set")
+	}
+	jti, err := newTokenID()
 	if err != nil {
 		return nil, err
 	}
-	ss, err := token.SignedString(pk)
+	now := time.Now()
+	claims := jwt.MapClaims{
+		ClaimsKeyJwtID: jti,
+		"iss":          host,
+		"iat":          now.Unix(),
+		"exp":          now.Add(j.resourceTokenLifetime()).Unix(),
+		"source":       source,
+		"sourceId":     id,
+		"db":           db,
+		"per":          perm,
+	}
+	if len(j.Claims.Audience) > 0 {
+		claims[ClaimsKeyAudience] = audienceClaim(j.Claims.Audience)
+	}
+	ss, err := j.signToken(claims, map[string]interface{}{HeaderKeyUsage: usageAccess})
 	if err != nil {
 		return nil, err
 	}
@@ -273,9 +500,10 @@ func (j *JwtConf) pareserRefreshToken(refreshToken string) (host string, data ma
 		return "", nil, err
 	}
 
+	// the refresh token comes from the client, every malformed input is an invalid token.
 	decodeData, err := base64.URLEncoding.DecodeString(refreshToken)
-	if err != nil {
-		return "", nil, err
+	if err != nil || len(decodeData) < gcm.NonceSize() {
+		return "", nil, apierrors.Error_Auth_Invalid_Token
 	}
 
 	nonceSize := gcm.NonceSize()
@@ -283,34 +511,46 @@ func (j *JwtConf) pareserRefreshToken(refreshToken string) (host string, data ma
 
 	compressData, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", nil, err
+		return "", nil, apierrors.Error_Auth_Invalid_Token
 	}
 
-	b := bytes.NewReader(compressData)
+	r, err := zlib.NewReader(bytes.NewReader(compressData))
+	if err != nil {
+		return "", nil, apierrors.Error_Auth_Invalid_Token
+	}
 	var out bytes.Buffer
-	r, _ := zlib.NewReader(b)
-	io.Copy(&out, r)
+	if _, err := io.Copy(&out, r); err != nil {
+		return "", nil, apierrors.Error_Auth_Invalid_Token
+	}
 	refreshStr := out.String()
 	jwtToken, err := jwt.Parse(refreshStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.Errorf("unexpected signing method [%v]", token.Header["alg"])
+		}
 		return []byte(j.RefreshSecret), nil
 	})
 	if err != nil {
-		return "", nil, err
+		return "", nil, apierrors.Error_Auth_Invalid_Token
+	}
+	data, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, apierrors.Error_Auth_Invalid_Token
+	}
+	host, ok = data["iss"].(string)
+	if !ok {
+		return "", nil, apierrors.Error_Auth_Invalid_Token
 	}
-	data = jwtToken.Claims.(jwt.MapClaims)
-	host = data["iss"].(string)
 	delete(data, "iss")
 	delete(data, "iat")
 	delete(data, "exp")
-	return
-
+	return host, data, nil
 }
 
 func (j *JwtConf) createRefreshToken(host string, data map[string]any) (string, error) {
 	now := time.Now()
 	data["iss"] = host
 	data["iat"] = now.Unix()
-	data["exp"] = now.AddDate(0, 0, 1).Unix()
+	data["exp"] = now.Add(refreshTokenDuration).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(data))
 	for k, v := range j.getHeader() {
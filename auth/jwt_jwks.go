@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultJwksCacheTTL        = time.Hour
+	defaultJwksRefreshInterval = time.Minute
+	defaultJwksFetchTimeout    = 10 * time.Second
+	maxJwksSize                = 1 << 20
+)
+
+// defaultJwksClient is used without JwksConf.HttpClient, so a hung endpoint can't block the refresh forever.
+var defaultJwksClient = &http.Client{Timeout: defaultJwksFetchTimeout}
+
+var errJwksNotSupported = errors.New("not supported by jwks verifier")
+
+// JwksConf verifies tokens with the keys of a remote JWKS url, it can't issue tokens.
+type JwksConf struct {
+	URL string `yaml:"url"`
+	// CacheTTL is how long the fetched keys are used before refreshing.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// MinRefreshInterval limits the refresh on an unknown kid.
+	MinRefreshInterval time.Duration `yaml:"min_refresh_interval"`
+	// Algorithms allowed to verify, the default is RS256, ES256, ES384 and EdDSA.
+	Algorithms []string `yaml:"algorithms"`
+	// Audience is the accepted aud, empty accepts any.
+	Audience []string `yaml:"aud"`
+	// Leeway is the clock skew allowed for exp, nbf and iat.
+	Leeway     time.Duration `yaml:"leeway"`
+	HttpClient *http.Client  `yaml:"-"`
+
+	once     sync.Once
+	verifier *jwksVerifier
+}
+
+func (j *JwksConf) GetKid() string {
+	return ""
+}
+
+// NewJwt returns the verifier shared by every call, so the key cache is shared.
+func (j *JwksConf) NewJwt() JwtToken {
+	j.once.Do(func() {
+		j.verifier = &jwksVerifier{conf: j, keys: make(map[string]jwksKey)}
+	})
+	return j.verifier
+}
+
+type jwksKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+var defaultJwksAlgorithms = []string{AlgRS256, AlgES256, AlgES384, AlgEdDSA}
+
+type jwksVerifier struct {
+	conf *JwksConf
+
+	lock        sync.Mutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time
+	lastRefresh time.Time
+	// refreshing is closed when the running fetch is done, nil when no fetch runs.
+	refreshing chan struct{}
+	refreshErr error
+}
+
+func (v *jwksVerifier) cacheTTL() time.Duration {
+	if v.conf.CacheTTL > 0 {
+		return v.conf.CacheTTL
+	}
+	return defaultJwksCacheTTL
+}
+
+func (v *jwksVerifier) refreshInterval() time.Duration {
+	if v.conf.MinRefreshInterval > 0 {
+		return v.conf.MinRefreshInterval
+	}
+	return defaultJwksRefreshInterval
+}
+
+func (v *jwksVerifier) httpClient() *http.Client {
+	if v.conf.HttpClient != nil {
+		return v.conf.HttpClient
+	}
+	return defaultJwksClient
+}
+
+func (v *jwksVerifier) fetch() (map[string]jwksKey, error) {
+	resp, err := v.httpClient().Get(v.conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetch jwks fail: status %d", resp.StatusCode)
+	}
+	var jwks JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJwksSize)).Decode(&jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jwksKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pk, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = jwksKey{key: pk, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+// refresh fetches the keys without holding the lock, the concurrent callers wait for the running fetch.
+// It's called with the lock held and returns with the lock held.
+func (v *jwksVerifier) refresh() error {
+	if ch := v.refreshing; ch != nil {
+		v.lock.Unlock()
+		<-ch
+		v.lock.Lock()
+		return v.refreshErr
+	}
+	ch := make(chan struct{})
+	v.refreshing = ch
+	startAt := time.Now()
+	v.lastRefresh = startAt
+	v.lock.Unlock()
+	keys, err := v.fetch()
+	v.lock.Lock()
+	if err == nil {
+		v.keys = keys
+		v.fetchedAt = startAt
+	}
+	v.refreshErr = err
+	v.refreshing = nil
+	close(ch)
+	return err
+}
+
+// getKey returns the key of kid, the keys are refreshed when expired,
+// or on an unknown kid at most once per refresh interval.
+// The expired keys are still used while refreshing or if the refresh fails.
+func (v *jwksVerifier) getKey(kid string) (jwksKey, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	now := time.Now()
+	if now.Sub(v.fetchedAt) > v.cacheTTL() && now.Sub(v.lastRefresh) > v.refreshInterval() {
+		if len(v.keys) == 0 {
+			_ = v.refresh()
+		} else {
+			go v.backgroundRefresh()
+			v.lastRefresh = now
+		}
+	}
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	if v.refreshing == nil && time.Since(v.lastRefresh) <= v.refreshInterval() {
+		return jwksKey{}, errors.Errorf("unknown kid [%s]", kid)
+	}
+	if err := v.refresh(); err != nil {
+		return jwksKey{}, err
+	}
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	return jwksKey{}, errors.Errorf("unknown kid [%s]", kid)
+}
+
+func (v *jwksVerifier) backgroundRefresh() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	_ = v.refresh()
+}
+
+// lookup finds the key of kid, a token without kid uses the only key.
+func (v *jwksVerifier) lookup(kid string) (jwksKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// keyFunc accepts the allowed algorithms only, the alg must match the key type and the alg of the jwk.
+func (v *jwksVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	algorithms := v.conf.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultJwksAlgorithms
+	}
+	alg := token.Method.Alg()
+	if !isStrInList(alg, algorithms...) {
+		return nil, errors.Errorf("unexpected signing method [%v]", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, err := v.getKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if (key.alg != "" && key.alg != alg) || !matchKeyAlg(alg, key.key) {
+		return nil, errors.Errorf("signing method [%s] not match the key", alg)
+	}
+	return key.key, nil
+}
+
+func (v *jwksVerifier) ParseToken(tokenStr string) (*jwt.Token, error) {
+	return parseValidToken(v, tokenStr, jwt.MapClaims{})
+}
+
+func (v *jwksVerifier) claimsValidation() claimsValidation {
+	return claimsValidation{audience: v.conf.Audience, leeway: v.conf.Leeway}
+}
+
+func (v *jwksVerifier) ParseTokenUnValidate(tokenStr string) (*jwt.Token, error) {
+	return parseTokenWithParser(&jwt.Parser{SkipClaimsValidation: true}, tokenStr, v.keyFunc)
+}
+
+func (v *jwksVerifier) GetToken(host string, data map[string]interface{}, exp uint8) (*string, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) GetTokenWithRefresh(host string, data map[string]interface{}, exp uint8) (*Token, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) GetAccessToken(host string, source string, id interface{}, db string, perm ApiPerm) (*string, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) RefreshAccessToken(refreshToken string) (*string, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) GetTokenWithDuration(host string, data map[string]interface{}, lifetime time.Duration) (*string, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) RotateRefreshToken(refreshToken string) (*Token, error) {
+	return nil, errJwksNotSupported
+}
+
+func (v *jwksVerifier) RevokeRefreshToken(refreshToken string) error {
+	return errJwksNotSupported
+}
+
+func parseTokenWithParser(parser *jwt.Parser, tokenStr string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	return parseTokenWithClaims(parser, tokenStr, jwt.MapClaims{}, keyFunc)
+}
+
+func parseTokenWithClaims(parser *jwt.Parser, tokenStr string, claims jwt.Claims, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	token, err := parser.ParseWithClaims(tokenStr, claims, keyFunc)
+	if token == nil {
+		return nil, errors.New("token is nil")
+	}
+	if token.Valid {
+		return token, nil
+	} else if ve, ok := err.(*jwt.ValidationError); ok {
+		if ve.Errors&jwt.ValidationErrorMalformed != 0 {
+			return nil, errors.New("That's not even a token")
+		} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
+			// Token is either expired or not active yet
+			return nil, errors.New("Timing is everything")
+		} else {
+			return nil, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJwksConfParseToken(t *testing.T) {
+	key1 := newTestJwtConf(t)
+	key2 := newTestJwtConf(t)
+	key2.Header.Kid = "kid-2"
+
+	var hits int32
+	var withKey2 atomic.Bool
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		jwks, _ := key1.GetJWKS()
+		if withKey2.Load() {
+			jwks2, _ := key2.GetJWKS()
+			jwks.Keys = append(jwks.Keys, jwks2.Keys...)
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer jwksServer.Close()
+
+	conf := &auth.JwksConf{URL: jwksServer.URL, MinRefreshInterval: 50 * time.Millisecond}
+	verifier := conf.NewJwt()
+	assert.Same(t, verifier, conf.NewJwt())
+
+	token1, err := key1.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	token, err := verifier.ParseToken(*token1)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", token.Claims.(jwt.MapClaims)["sub"])
+	_, err = verifier.ParseToken(*token1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// unknown kid is rate limited
+	withKey2.Store(true)
+	token2, err := key2.GetToken("example.com", map[string]interface{}{"sub": "u2"}, 10)
+	assert.NoError(t, err)
+	_, err = verifier.ParseToken(*token2)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = verifier.ParseToken(*token2)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	_, err = verifier.GetToken("example.com", map[string]interface{}{}, 10)
+	assert.Error(t, err)
+}
+
+func TestJwksConfRefreshDoesNotBlock(t *testing.T) {
+	key := newTestJwtConf(t)
+	var hang atomic.Bool
+	release := make(chan struct{})
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			<-release
+		}
+		jwks, _ := key.GetJWKS()
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer jwksServer.Close()
+	defer close(release)
+
+	conf := &auth.JwksConf{URL: jwksServer.URL, CacheTTL: time.Millisecond, MinRefreshInterval: time.Millisecond}
+	verifier := conf.NewJwt()
+	tokenStr, err := key.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	_, err = verifier.ParseToken(*tokenStr)
+	assert.NoError(t, err)
+
+	// the expired keys verify while the refresh hangs
+	hang.Store(true)
+	time.Sleep(5 * time.Millisecond)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := verifier.ParseToken(*tokenStr)
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("verification blocked by the jwks refresh")
+		}
+	}
+}
+
+func TestJwksConfBodyLimit(t *testing.T) {
+	key := newTestJwtConf(t)
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[],"pad":"`))
+		w.Write([]byte(strings.Repeat("a", 2<<20)))
+		w.Write([]byte(`"}`))
+	}))
+	defer jwksServer.Close()
+
+	tokenStr, err := key.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	_, err = (&auth.JwksConf{URL: jwksServer.URL}).NewJwt().ParseToken(*tokenStr)
+	assert.Error(t, err)
+}
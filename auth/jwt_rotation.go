@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VerifyKey is a rotated public key of JwtConf, tokens signed by it are accepted until RetireAt.
+// A zero RetireAt never retires.
+type VerifyKey struct {
+	Kid string `yaml:"kid"`
+	// Alg is the algorithm of the key, the default is the JwtConf Algorithm.
+	Alg           string    `yaml:"alg"`
+	PublicKeyFile string    `yaml:"publickey"`
+	RetireAt      time.Time `yaml:"retire_at"`
+}
+
+func (k VerifyKey) isRetired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// getVerifyKey returns the public key and algorithm of a verify key.
+func (j *JwtConf) getVerifyKey(kid string, now time.Time) (crypto.PublicKey, string, error) {
+	j.lock.RLock()
+	var key *VerifyKey
+	for i := range j.VerifyKeys {
+		if j.VerifyKeys[i].Kid == kid {
+			key = &j.VerifyKeys[i]
+			break
+		}
+	}
+	if key == nil {
+		j.lock.RUnlock()
+		return nil, "", errors.Errorf("unknown kid [%s]", kid)
+	}
+	if key.isRetired(now) {
+		j.lock.RUnlock()
+		return nil, "", errors.Errorf("kid [%s] is retired", kid)
+	}
+	alg := key.Alg
+	if alg == "" {
+		alg = j.Algorithm
+	}
+	pk, ok := j.verifyPKs[kid]
+	file := key.PublicKeyFile
+	j.lock.RUnlock()
+	if ok {
+		return pk, alg, nil
+	}
+
+	publicData, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	pk, err = parsePublicKeyFromPEM(publicData)
+	if err != nil {
+		return nil, "", err
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.verifyPKs == nil {
+		j.verifyPKs = make(map[string]crypto.PublicKey)
+	}
+	j.verifyPKs[kid] = pk
+	return pk, alg, nil
+}
+
+// getActiveVerifyKeys returns the verify keys not retired at now.
+func (j *JwtConf) getActiveVerifyKeys(now time.Time) []VerifyKey {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	var keys []VerifyKey
+	for _, k := range j.VerifyKeys {
+		if !k.isRetired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// RotateKeys generates a new key pair of Algorithm to privateFile and publicFile which signs the new tokens as kid.
+// The current key keeps verifying tokens for retireAfter, zero never retires.
+// The current key must have a kid, the tokens without kid are verified by the signing key only.
+// The caller should persist the changed PrivateKeyFile, PublicKeyFile, Header.Kid and VerifyKeys.
+func (j *JwtConf) RotateKeys(kid, privateFile, publicFile string, bitsize int, retireAfter time.Duration) error {
+	current := j.GetKid()
+	if current == "" {
+		return errors.New("current key has no kid")
+	}
+	if kid == "" || kid == current {
+		return errors.New("new kid must be different from the current kid")
+	}
+	if isStrInList(privateFile, j.PrivateKeyFile, j.PublicKeyFile) || isStrInList(publicFile, j.PrivateKeyFile, j.PublicKeyFile) {
+		return errors.New("new key files must be different from the current key files")
+	}
+	if err := GenerateKeys(j.Algorithm, bitsize, privateFile, publicFile); err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	old := VerifyKey{Kid: j.Header.Kid, Alg: j.Algorithm, PublicKeyFile: j.PublicKeyFile}
+	if retireAfter > 0 {
+		old.RetireAt = time.Now().Add(retireAfter)
+	}
+	if j.publicKey != nil {
+		if j.verifyPKs == nil {
+			j.verifyPKs = make(map[string]crypto.PublicKey)
+		}
+		j.verifyPKs[old.Kid] = j.publicKey
+	}
+	j.VerifyKeys = append(j.VerifyKeys, old)
+	j.Header.Kid = kid
+	j.PrivateKeyFile = privateFile
+	j.PublicKeyFile = publicFile
+	j.privateKey = nil
+	j.publicKey = nil
+	return nil
+}
+
+// PruneRetiredKeys removes the retired verify keys and returns the removed kids.
+func (j *JwtConf) PruneRetiredKeys() []string {
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	var removed []string
+	keys := j.VerifyKeys[:0]
+	for _, k := range j.VerifyKeys {
+		if k.isRetired(now) {
+			removed = append(removed, k.Kid)
+			delete(j.verifyPKs, k.Kid)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	j.VerifyKeys = keys
+	return removed
+}
@@ -0,0 +1,64 @@
+package auth_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJwtConfRotateKeys(t *testing.T) {
+	j := newTestJwtConf(t)
+	oldToken, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.Error(t, j.RotateKeys("test-kid", filepath.Join(dir, "p"), filepath.Join(dir, "k"), 2048, time.Hour))
+	err = j.RotateKeys("kid-2", filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem"), 2048, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "kid-2", j.GetKid())
+	assert.Len(t, j.VerifyKeys, 1)
+
+	newToken, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	token, err := j.ParseToken(*newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "kid-2", token.Header["kid"])
+	_, err = j.ParseToken(*oldToken)
+	assert.NoError(t, err)
+
+	jwks, err := j.GetJWKS()
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "kid-2", jwks.Keys[0].Kid)
+	assert.Equal(t, "test-kid", jwks.Keys[1].Kid)
+
+	// retire the old key
+	j.VerifyKeys[0].RetireAt = time.Now().Add(-time.Second)
+	_, err = j.ParseToken(*oldToken)
+	assert.Error(t, err)
+	jwks, err = j.GetJWKS()
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, []string{"test-kid"}, j.PruneRetiredKeys())
+	assert.Empty(t, j.VerifyKeys)
+}
+
+func TestJwtConfRotateKeysRejects(t *testing.T) {
+	j := newTestJwtConf(t)
+	dir := t.TempDir()
+	assert.Error(t, j.RotateKeys("kid-2", j.PrivateKeyFile, filepath.Join(dir, "public.pem"), 2048, time.Hour))
+	assert.Error(t, j.RotateKeys("kid-2", filepath.Join(dir, "private.pem"), j.PublicKeyFile, 2048, time.Hour))
+	assert.Equal(t, "test-kid", j.GetKid())
+	assert.Empty(t, j.VerifyKeys)
+
+	token, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	_, err = j.ParseToken(*token)
+	assert.NoError(t, err, "current key files are kept")
+
+	j.Header.Kid = ""
+	assert.Error(t, j.RotateKeys("kid-2", filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem"), 2048, time.Hour))
+	assert.Empty(t, j.VerifyKeys)
+}
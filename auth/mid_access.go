@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/94peter/api-toolkit/mid"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// AccessTokenQueryKey is the query parameter of the access token in a shared link.
+	AccessTokenQueryKey = "access_token"
+	usageAccess         = "access"
+
+	_KEY_ACCESS_SCOPE     = "api_toolkit_access_scope"
+	_CTX_KEY_ACCESS_SCOPE = ctxKey(_KEY_ACCESS_SCOPE)
+)
+
+// AccessScope is the resource granted by an access token of JwtConf.GetAccessToken.
+type AccessScope struct {
+	Host     string
+	Source   string
+	SourceID string
+	DB       string
+	Perm     ApiPerm
+}
+
+// NewAccessScopeFromToken maps the claims of an access token to AccessScope,
+// the token must have the usa: access header.
+func NewAccessScopeFromToken(token *jwt.Token) (*AccessScope, error) {
+	if usage, _ := token.Header[HeaderKeyUsage].(string); usage != usageAccess {
+		return nil, errors.Error_Auth_Invalid_Token
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.Error_Auth_Invalid_Token
+	}
+	scope := &AccessScope{
+		Host:   getStrClaim(claims, ClaimsKeyIssuer),
+		Source: getStrClaim(claims, "source"),
+		DB:     getStrClaim(claims, "db"),
+		Perm:   ApiPerm(getStrClaim(claims, "per")),
+	}
+	if id, ok := claims["sourceId"]; ok && id != nil {
+		scope.SourceID = fmt.Sprint(id)
+	}
+	return scope, nil
+}
+
+func GetAccessScopeFromGin(c *gin.Context) *AccessScope {
+	data, ok := c.Get(_KEY_ACCESS_SCOPE)
+	if !ok {
+		return nil
+	}
+	return data.(*AccessScope)
+}
+
+func GetAccessScopeFromCtx(ctx context.Context) *AccessScope {
+	scope, _ := ctx.Value(_CTX_KEY_ACCESS_SCOPE).(*AccessScope)
+	return scope
+}
+
+type AccessTokenOption func(*accessTokenMiddle)
+
+// AccessTokenWithIdParam checks the route path parameter idParam equals the sourceId of the token.
+func AccessTokenWithIdParam(idParam string) AccessTokenOption {
+	return func(m *accessTokenMiddle) {
+		m.idParam = idParam
+	}
+}
+
+// AccessTokenWithPerms requires the per of the token to satisfy one of perms, wildcards are matched by MatchPerm.
+func AccessTokenWithPerms(perms ...ApiPerm) AccessTokenOption {
+	return func(m *accessTokenMiddle) {
+		m.perms = perms
+	}
+}
+
+// AccessTokenWithRevocationStore rejects the revoked tokens, the check fails closed on a store error.
+// The default is Revocations of JwtConf.
+func AccessTokenWithRevocationStore(store RevocationStore) AccessTokenOption {
+	return func(m *accessTokenMiddle) {
+		m.revocations = store
+	}
+}
+
+func AccessTokenWithRealm(realm string) AccessTokenOption {
+	return func(m *accessTokenMiddle) {
+		m.realm = realm
+	}
+}
+
+// NewGinAccessTokenMid returns a route middleware verifying the access tokens of JwtConf.GetAccessToken,
+// the token is read from the bearer header or the access_token query parameter.
+// The source of the token must be source, the granted AccessScope is bound to gin and request context.
+// Add it to GinApiHandler.Middles of the shared routes, e.g.
+//
+//	Path:    "/v1/orders/:id",
+//	Middles: []mid.GinMiddle{auth.NewGinAccessTokenMid(jwtConf, "order", auth.AccessTokenWithIdParam("id"), auth.AccessTokenWithPerms("read"))},
+func NewGinAccessTokenMid(di JwtDI, source string, opts ...AccessTokenOption) mid.GinMiddle {
+	m := &accessTokenMiddle{
+		jwtToken: di.NewJwt(),
+		source:   source,
+	}
+	if conf, ok := di.(*JwtConf); ok {
+		m.revocations = conf.Revocations
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+type accessTokenMiddle struct {
+	errors.CommonApiErrorHandler
+	jwtToken    JwtToken
+	source      string
+	idParam     string
+	perms       []ApiPerm
+	realm       string
+	revocations RevocationStore
+}
+
+func (m *accessTokenMiddle) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr := c.Query(AccessTokenQueryKey)
+		if authToken := c.GetHeader(BearerAuthTokenKey); authToken != "" {
+			if !strings.HasPrefix(authToken, "Bearer ") {
+				m.abort(c, errors.Error_Auth_Invalid_Token, bearerErrInvalidRequest)
+				return
+			}
+			tokenStr = strings.TrimPrefix(authToken, "Bearer ")
+		}
+		if tokenStr == "" {
+			m.abort(c, errors.Error_Auth_Miss_Token, "")
+			return
+		}
+		token, err := m.jwtToken.ParseToken(tokenStr)
+		if err != nil {
+			m.abort(c, errors.Error_Auth_Invalid_Token, bearerErrInvalidToken)
+			return
+		}
+		scope, err := NewAccessScopeFromToken(token)
+		if err != nil {
+			m.abort(c, err, bearerErrInvalidToken)
+			return
+		}
+		if m.isRevoked(token) {
+			m.abort(c, errors.Error_Auth_Invalid_Token, bearerErrInvalidToken)
+			return
+		}
+		if scope.Source != m.source || (m.idParam != "" && scope.SourceID != c.Param(m.idParam)) {
+			m.abort(c, errors.Error_Auth_No_Perm, bearerErrInsufficientScope)
+			return
+		}
+		if !hasAnyPerm(m.perms, []string{string(scope.Perm)}) {
+			m.abort(c, errors.Error_Auth_No_Perm, bearerErrInsufficientScope)
+			return
+		}
+		c.Set(_KEY_ACCESS_SCOPE, scope)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), _CTX_KEY_ACCESS_SCOPE, scope))
+		c.Next()
+	}
+}
+
+func (m *accessTokenMiddle) abort(c *gin.Context, err error, bearerErr string) {
+	abortWithChallenge(c, m.GinApiErrorHandler, "Bearer", m.realm, err, bearerErr)
+}
+
+func (m *accessTokenMiddle) isRevoked(token *jwt.Token) bool {
+	if m.revocations == nil {
+		return false
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	jti := getStrClaim(claims, ClaimsKeyJwtID)
+	if jti == "" {
+		return false
+	}
+	revoked, err := m.revocations.IsRevoked(jti)
+	return err != nil || revoked
+}
@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinAccessTokenMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+
+	m := auth.NewGinAccessTokenMid(j, "order",
+		auth.AccessTokenWithIdParam("id"), auth.AccessTokenWithPerms("order:read"))
+	m.SetApiErrorHandler(testErrorHandler)
+	r := gin.New()
+	r.GET("/orders/:id", m.Handler(), func(c *gin.Context) {
+		scope := auth.GetAccessScopeFromGin(c)
+		assert.Equal(t, scope, auth.GetAccessScopeFromCtx(c.Request.Context()))
+		c.String(http.StatusOK, scope.DB+":"+string(scope.Perm))
+	})
+
+	accessToken := func(source string, id interface{}, perm auth.ApiPerm) string {
+		token, err := j.GetAccessToken("example.com", source, id, "db1", perm)
+		assert.NoError(t, err)
+		return *token
+	}
+	userToken, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		url        string
+		authHeader string
+		statusCode int
+		body       string
+	}{
+		{name: "miss token", url: "/orders/1", statusCode: http.StatusUnauthorized},
+		{name: "user token", url: "/orders/1", authHeader: "Bearer " + *userToken, statusCode: http.StatusUnauthorized},
+		{name: "other source", url: "/orders/1", authHeader: "Bearer " + accessToken("invoice", 1, "order:read"), statusCode: http.StatusForbidden},
+		{name: "other id", url: "/orders/2", authHeader: "Bearer " + accessToken("order", 1, "order:read"), statusCode: http.StatusForbidden},
+		{name: "no perm", url: "/orders/1", authHeader: "Bearer " + accessToken("order", 1, "order:write"), statusCode: http.StatusForbidden},
+		{name: "header", url: "/orders/1", authHeader: "Bearer " + accessToken("order", 1, "order:read"), statusCode: http.StatusOK, body: "db1:order:read"},
+		{name: "shared link", url: "/orders/abc?access_token=" + accessToken("order", "abc", "order:*"), statusCode: http.StatusOK, body: "db1:order:*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.authHeader != "" {
+				req.Header.Set(auth.BearerAuthTokenKey, tt.authHeader)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGinAccessTokenMidRevocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+	j.Revocations = auth.NewMemoryRevocationStore()
+	m := auth.NewGinAccessTokenMid(j, "order")
+	m.SetApiErrorHandler(testErrorHandler)
+	r := gin.New()
+	r.GET("/orders/:id", m.Handler(), func(c *gin.Context) {})
+
+	get := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/orders/1?access_token="+token, nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	tokenStr, err := j.GetAccessToken("example.com", "order", 1, "db1", "order:read")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(*tokenStr))
+
+	token, err := j.ParseToken(*tokenStr)
+	assert.NoError(t, err)
+	assert.NotNil(t, token.Claims.(jwt.MapClaims)["exp"])
+	assert.NoError(t, auth.RevokeToken(j.Revocations, token, j.Claims.Leeway))
+	assert.Equal(t, http.StatusUnauthorized, get(*tokenStr))
+
+	j.Claims.AccessExpDuration = time.Hour
+	tokenStr, err = j.GetAccessToken("example.com", "order", 1, "db1", "order:read")
+	assert.NoError(t, err)
+	token, err = j.ParseToken(*tokenStr)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, float64(3600), claims["exp"].(float64)-claims["iat"].(float64))
+}
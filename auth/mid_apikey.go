@@ -0,0 +1,61 @@
+package auth
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ApiKeyHeaderKey = "X-API-Key"
+	ApiKeyQueryKey  = "api_key"
+	usageApiKey     = "api_key"
+
+	// apiKeyTouchInterval limits the last used writes of a busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+// NewGinApiKeyAuthMid returns an auth middleware for machine clients, the key is read from
+// the X-API-Key header or the api_key query parameter and looked up by its hash in store.
+// The perms of the key are checked with the groups of AddAuthPath like the bearer middleware.
+func NewGinApiKeyAuthMid(store ApiKeyStore, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(false, []*AuthScheme{NewApiKeyAuthScheme(store)}, opts...)
+}
+
+func NewApiKeyAuthScheme(store ApiKeyStore) *AuthScheme {
+	return &AuthScheme{
+		name:      AuthSchemeApiKey,
+		challenge: "ApiKey",
+		getToken:  getApiKey,
+		loadUser:  newApiKeyReqUserLoader(store),
+	}
+}
+
+func getApiKey(c *gin.Context) (string, bool) {
+	if key := c.GetHeader(ApiKeyHeaderKey); key != "" {
+		return key, true
+	}
+	return c.Query(ApiKeyQueryKey), true
+}
+
+func newApiKeyReqUserLoader(store ApiKeyStore) reqUserLoader {
+	return func(c *gin.Context, plain string) (ReqUser, error) {
+		key, err := store.GetByHash(HashApiKey(plain))
+		if stderrors.Is(err, ErrApiKeyNotFound) {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if key.isExpired(now) {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		if now.Sub(key.LastUsedAt) > apiKeyTouchInterval {
+			_ = store.Touch(key.ID, now)
+		}
+		return NewReqUser(getHost(c.Request), key.UserID, key.Account, key.Name, key.Perms, usageApiKey), nil
+	}
+}
@@ -0,0 +1,75 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinApiKeyAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := auth.NewMemoryApiKeyStore()
+	key := &auth.ApiKey{UserID: "cron", Account: "cron-job", Perms: []string{"report:*"}}
+	plain, err := auth.CreateApiKey(store, key)
+	assert.NoError(t, err)
+	expired, err := auth.CreateApiKey(store, &auth.ApiKey{UserID: "old", Perms: []string{"*"},
+		ExpiresAt: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+
+	stored, err := store.GetByHash(auth.HashApiKey(plain))
+	assert.NoError(t, err)
+	assert.NotContains(t, stored.Hash, plain)
+
+	m := auth.NewGinApiKeyAuthMid(store)
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/reports", http.MethodGet, true, []auth.ApiPerm{"report:read"})
+	m.AddAuthPath("/users", http.MethodGet, true, []auth.ApiPerm{"user:read"})
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		u := auth.GetReqUserFromGin(c)
+		c.String(http.StatusOK, u.GetId()+":"+u.GetUsage())
+	}
+	r.GET("/reports", m.Handler(), handler)
+	r.GET("/users", m.Handler(), handler)
+
+	tests := []struct {
+		name       string
+		url        string
+		header     string
+		statusCode int
+		body       string
+	}{
+		{name: "miss key", url: "/reports", statusCode: http.StatusUnauthorized},
+		{name: "unknown key", url: "/reports", header: "ak_unknown", statusCode: http.StatusUnauthorized},
+		{name: "expired key", url: "/reports", header: expired, statusCode: http.StatusUnauthorized},
+		{name: "no perm", url: "/users", header: plain, statusCode: http.StatusForbidden},
+		{name: "header", url: "/reports", header: plain, statusCode: http.StatusOK, body: "cron:api_key"},
+		{name: "query", url: "/reports?api_key=" + plain, statusCode: http.StatusOK, body: "cron:api_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set(auth.ApiKeyHeaderKey, tt.header)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+
+	stored, err = store.GetByHash(auth.HashApiKey(plain))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), stored.LastUsedAt, time.Minute)
+	assert.NoError(t, store.Delete(key.ID))
+	_, err = store.GetByHash(auth.HashApiKey(plain))
+	assert.ErrorIs(t, err, auth.ErrApiKeyNotFound)
+}
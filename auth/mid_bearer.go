@@ -10,12 +10,51 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func NewGinBearAuthMid(isMatchHost bool) GinAuthMidInter {
-	return &bearAuthMiddle{
+func NewGinBearAuthMid(isMatchHost bool, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(isMatchHost, []*AuthScheme{NewBearerAuthScheme()}, opts...)
+}
+
+func newBearAuthMiddle(isMatchHost bool, schemes []*AuthScheme, opts ...BearAuthOption) *bearAuthMiddle {
+	m := &bearAuthMiddle{
 		authMap:     make(map[string]uint8),
 		groupMap:    make(map[string][]ApiPerm),
+		schemeMap:   make(map[string][]string),
 		isMatchHost: isMatchHost,
+		schemes:     schemes,
+		errs:        defaultAuthErrors(),
+	}
+	if len(schemes) > 0 {
+		m.challenge = schemes[0].challenge
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// reqUserLoader resolves the request user from the credential returned by the tokenExtractor.
+type reqUserLoader func(c *gin.Context, token string) (ReqUser, error)
+
+// tokenExtractor returns the credential of the request, ok is false on a malformed credential.
+type tokenExtractor func(c *gin.Context) (token string, ok bool)
+
+func getBearerToken(c *gin.Context) (string, bool) {
+	authToken := c.GetHeader(BearerAuthTokenKey)
+	if authToken == "" {
+		return "", true
 	}
+	if !strings.HasPrefix(authToken, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(authToken, "Bearer "), true
+}
+
+func getReqUserFromGinCtx(c *gin.Context, token string) (ReqUser, error) {
+	reqUser := GetReqUserFromGin(c)
+	if reqUser == nil {
+		return nil, errors.Error_Auth_Miss_Token
+	}
+	return reqUser, nil
 }
 
 func (lm *bearAuthMiddle) GetName() string {
@@ -26,7 +65,18 @@ type bearAuthMiddle struct {
 	errors.CommonApiErrorHandler
 	authMap     map[string]uint8
 	groupMap    map[string][]ApiPerm
+	schemeMap   map[string][]string
 	isMatchHost bool
+	schemes     []*AuthScheme
+	challenge   string
+	errs        AuthErrors
+	realm       string
+	rolePerms   RolePerms
+	permRules   []PermRule
+
+	authorizer     Authorizer
+	decisionLogger DecisionLogger
+	revocations    RevocationStore
 }
 
 type ctxKey string
@@ -78,27 +128,33 @@ func (am *bearAuthMiddle) AddAuthPath(path string, method string, isAuth bool, g
 	am.groupMap[key] = group
 }
 
+// IsAuth looks up the path and method, then the path registered with MethodAnyPerm.
 func (am *bearAuthMiddle) IsAuth(path string, method string) bool {
-	key := getPathKey(path, method)
-	value, ok := am.authMap[key]
-	if ok {
-		return (value & authValue) > 0
+	for _, m := range []string{method, MethodAnyPerm} {
+		if value, ok := am.authMap[getPathKey(path, m)]; ok {
+			return (value & authValue) > 0
+		}
 	}
 	return false
 }
 
+// HasPerm checks the route group and the matched permission rules,
+// perm is expanded with the role permissions and matched with wildcards.
 func (am *bearAuthMiddle) HasPerm(path, method string, perm []string) bool {
-	key := fmt.Sprintf("%s:%s", path, method)
-	groupAry, ok := am.groupMap[key]
-	if !ok || groupAry == nil || len(groupAry) == 0 {
-		return true
+	granted := am.rolePerms.Expand(perm)
+	groupAry, ok := am.groupMap[getPathKey(path, method)]
+	if !ok {
+		groupAry = am.groupMap[getPathKey(path, MethodAnyPerm)]
 	}
-	for _, g := range groupAry {
-		if isStrInList(string(g), perm...) {
-			return true
+	if !hasAnyPerm(groupAry, granted) {
+		return false
+	}
+	for _, rule := range am.permRules {
+		if rule.match(path, method) && !hasAnyPerm(rule.Perms, granted) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 func (m *bearAuthMiddle) Handler() gin.HandlerFunc {
@@ -106,42 +162,35 @@ func (m *bearAuthMiddle) Handler() gin.HandlerFunc {
 		path := c.FullPath()
 		method := c.Request.Method
 		if path == "" {
-			m.GinApiErrorHandler(c, errors.Error_Auth_Path_NotFound)
+			m.GinApiErrorHandler(c, m.errs.PathNotFound)
 			c.Abort()
 			return
 		}
 		if m.IsAuth(path, method) {
-			authToken := c.GetHeader(BearerAuthTokenKey)
-			if authToken == "" {
-				m.GinApiErrorHandler(c, errors.Error_Auth_Miss_Token)
-				c.Abort()
+			reqUser, scheme, bearerErr, err := m.authenticate(c, path, method)
+			if err != nil {
+				m.abort(c, err, bearerErr)
 				return
 			}
 
-			if !strings.HasPrefix(authToken, "Bearer ") {
-				m.GinApiErrorHandler(c, errors.Error_Auth_Invalid_Token)
-				c.Abort()
+			if m.revocations != nil && m.isRevoked(reqUser) {
+				m.abort(c, m.errs.InvalidToken, bearerErrInvalidToken)
 				return
 			}
 
-			u, ok := c.Get(_KEY_USER_INFO)
-			if !ok {
-				m.GinApiErrorHandler(c, errors.Error_Auth_Miss_Token)
-				c.Abort()
+			host := getHost(c.Request)
+			if m.isMatchHost && scheme.hostBound && reqUser.GetHost() != host {
+				m.abort(c, m.errs.HostNotMatch, bearerErrInvalidToken)
 				return
 			}
-			reqUser := u.(ReqUser)
 
-			host := getHost(c.Request)
-			if m.isMatchHost && reqUser.GetHost() != host {
-				m.GinApiErrorHandler(c, errors.Error_Auth_Host_Not_Match)
-				c.Abort()
+			if hasPerm := m.HasPerm(path, method, reqUser.GetPerms()); !hasPerm {
+				m.abort(c, m.errs.NoPerm, bearerErrInsufficientScope)
 				return
 			}
 
-			if hasPerm := m.HasPerm(path, method, reqUser.GetPerms()); !hasPerm {
-				m.GinApiErrorHandler(c, errors.Error_Auth_No_Perm)
-				c.Abort()
+			if m.authorizer != nil && !m.authorize(c, reqUser) {
+				m.abort(c, m.errs.NoPerm, bearerErrInsufficientScope)
 				return
 			}
 		}
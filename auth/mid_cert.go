@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const usageCert = "mtls"
+
+// CertUserMapper maps a verified client certificate to the ReqUser,
+// return errors.Error_Auth_Invalid_Token to reject the certificate.
+type CertUserMapper func(cert *x509.Certificate) (ReqUser, error)
+
+// NewCertUserMapper maps a certificate by its identities, the URI SANs (e.g. spiffe://), DNS SANs,
+// email SANs and then the subject common name, the first identity in perms is the user id
+// and the account is the common name. A certificate without a known identity is rejected.
+func NewCertUserMapper(perms map[string][]string) CertUserMapper {
+	return func(cert *x509.Certificate) (ReqUser, error) {
+		for _, id := range getCertIdentities(cert) {
+			if p, ok := perms[id]; ok {
+				return NewReqUser("", id, cert.Subject.CommonName, cert.Subject.CommonName, p, usageCert), nil
+			}
+		}
+		return nil, errors.Error_Auth_Invalid_Token
+	}
+}
+
+func getCertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// NewGinCertAuthMid returns an auth middleware authenticating the client certificate verified by
+// the mutual TLS server (see apitool.TLSConfig), the perms of the mapped ReqUser are checked with
+// the groups of AddAuthPath. Unverified peer certificates are ignored.
+func NewGinCertAuthMid(mapper CertUserMapper, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(false, []*AuthScheme{NewCertAuthScheme(mapper)}, opts...)
+}
+
+func NewCertAuthScheme(mapper CertUserMapper) *AuthScheme {
+	return &AuthScheme{
+		name:     AuthSchemeCert,
+		getToken: getVerifiedCertID,
+		loadUser: newCertReqUserLoader(mapper),
+	}
+}
+
+func getVerifiedClientCert(c *gin.Context) *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// getVerifiedCertID is the credential of the middleware, the loader maps the certificate itself.
+// It's the subject, or the sha256 fingerprint of the SAN only certificates (e.g. SPIFFE).
+func getVerifiedCertID(c *gin.Context) (string, bool) {
+	cert := getVerifiedClientCert(c)
+	if cert == nil {
+		return "", true
+	}
+	if subject := cert.Subject.String(); subject != "" {
+		return subject, true
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:]), true
+}
+
+func newCertReqUserLoader(mapper CertUserMapper) reqUserLoader {
+	return func(c *gin.Context, _ string) (ReqUser, error) {
+		cert := getVerifiedClientCert(c)
+		if cert == nil {
+			return nil, errors.Error_Auth_Miss_Token
+		}
+		return mapper(cert)
+	}
+}
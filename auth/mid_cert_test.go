@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+func TestGinCertAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ca, caKey := newTestCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "test-ca"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	newClientCert := func(cn string, uri string) tls.Certificate {
+		tmpl := &x509.Certificate{Subject: pkix.Name{CommonName: cn},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+		if uri != "" {
+			u, _ := url.Parse(uri)
+			tmpl.URIs = []*url.URL{u}
+		}
+		cert, key := newTestCert(t, tmpl, ca, caKey)
+		return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+	}
+
+	m := auth.NewGinCertAuthMid(auth.NewCertUserMapper(map[string][]string{
+		"spiffe://internal/billing": {"invoice:*"},
+		"report-job":                {"report:read"},
+	}))
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/invoices", http.MethodGet, true, []auth.ApiPerm{"invoice:read"})
+	r := gin.New()
+	r.GET("/invoices", m.Handler(), func(c *gin.Context) {
+		u := auth.GetReqUserFromGin(c)
+		c.String(http.StatusOK, u.GetId()+":"+u.GetAccount())
+	})
+
+	server := httptest.NewUnstartedServer(r)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(certs ...tls.Certificate) (int, string) {
+		// a new transport per call, the connections are not reused
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(server.URL + "/invoices")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		buf := make([]byte, 128)
+		n, _ := resp.Body.Read(buf)
+		return resp.StatusCode, string(buf[:n])
+	}
+
+	code, _ := get()
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get(newClientCert("unknown", ""))
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get(newClientCert("report-job", ""))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, body := get(newClientCert("billing", "spiffe://internal/billing"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "spiffe://internal/billing:billing", body)
+	code, body = get(newClientCert("", "spiffe://internal/billing"))
+	assert.Equal(t, http.StatusOK, code, "SAN only certificate")
+	assert.Equal(t, "spiffe://internal/billing:", body)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHmacMaxSkew = 5 * time.Minute
+	maxHmacBodySize    = 10 << 20
+	usageHmac          = "hmac"
+)
+
+type HmacAuthConf struct {
+	Keys HmacKeyStore
+	// Nonces rejects the replayed requests, the default is a memory store.
+	Nonces NonceStore
+	// MaxSkew is the max difference of the signed timestamp and now, the default is 5 minutes.
+	MaxSkew time.Duration
+}
+
+// NewGinHmacAuthMid returns an auth middleware verifying the requests signed by HmacSigner,
+// the key id resolves the ReqUser and its perms are checked with the groups of AddAuthPath.
+func NewGinHmacAuthMid(conf HmacAuthConf, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(false, []*AuthScheme{NewHmacAuthScheme(conf)}, opts...)
+}
+
+func NewHmacAuthScheme(conf HmacAuthConf) *AuthScheme {
+	if conf.Nonces == nil {
+		conf.Nonces = NewMemoryNonceStore()
+	}
+	if conf.MaxSkew <= 0 {
+		conf.MaxSkew = defaultHmacMaxSkew
+	}
+	return &AuthScheme{
+		name:      AuthSchemeHmac,
+		challenge: HmacScheme,
+		getToken:  getHmacAuthorization,
+		loadUser:  newHmacReqUserLoader(conf),
+	}
+}
+
+func getHmacAuthorization(c *gin.Context) (string, bool) {
+	authToken := c.GetHeader(BearerAuthTokenKey)
+	if authToken == "" {
+		return "", true
+	}
+	if !strings.HasPrefix(authToken, HmacScheme+" ") {
+		return "", false
+	}
+	return strings.TrimPrefix(authToken, HmacScheme+" "), true
+}
+
+func newHmacReqUserLoader(conf HmacAuthConf) reqUserLoader {
+	return func(c *gin.Context, authorization string) (ReqUser, error) {
+		p, err := parseHmacParams(authorization)
+		if err != nil {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		ts, err := strconv.ParseInt(p.ts, 10, 64)
+		if err != nil {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		signedAt := time.Unix(ts, 0)
+		if d := time.Since(signedAt); d > conf.MaxSkew || d < -conf.MaxSkew {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		key, err := conf.Keys.GetHmacKey(p.keyID)
+		if stderrors.Is(err, ErrHmacKeyNotFound) {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := readHmacBody(c)
+		if err != nil {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		uri := c.Request.RequestURI
+		if uri == "" {
+			uri = c.Request.URL.RequestURI()
+		}
+		expected := hmacSign(key.Secret, hmacStringToSign(c.Request.Method, uri, c.Request.Host, c.Request.Header, p, body))
+		if !hmacEqual(expected, p.signature) {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		// the nonce is used after the signature check, so a forged request can't burn it
+		ok, err := conf.Nonces.Use(p.keyID+":"+p.nonce, signedAt.Add(conf.MaxSkew))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+
+		return NewReqUser(getHost(c.Request), key.UserID, key.Account, key.Name, key.Perms, usageHmac), nil
+	}
+}
+
+// readHmacBody reads the body up to maxHmacBodySize and restores it for the handler.
+func readHmacBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxHmacBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxHmacBodySize {
+		return nil, stderrors.New("body too large")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
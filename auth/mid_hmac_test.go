@@ -0,0 +1,92 @@
+package auth_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinHmacAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := auth.NewMemoryHmacKeyStore(auth.HmacKey{
+		ID: "billing", Secret: []byte("secret"), UserID: "billing-svc", Perms: []string{"invoice:write"},
+	})
+	newServer := func(maxSkew time.Duration) *httptest.Server {
+		m := auth.NewGinHmacAuthMid(auth.HmacAuthConf{Keys: keys, MaxSkew: maxSkew})
+		m.SetApiErrorHandler(testErrorHandler)
+		m.AddAuthPath("/invoices", http.MethodPost, true, []auth.ApiPerm{"invoice:write"})
+		r := gin.New()
+		r.POST("/invoices", m.Handler(), func(c *gin.Context) {
+			body, _ := io.ReadAll(c.Request.Body)
+			c.String(http.StatusOK, auth.GetReqUserFromGin(c).GetId()+":"+string(body))
+		})
+		return httptest.NewServer(r)
+	}
+	server := newServer(0)
+	defer server.Close()
+
+	var lastReq *http.Request
+	capture := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		lastReq = req
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: auth.NewHmacRoundTripper(&auth.HmacSigner{
+		KeyID: "billing", Secret: []byte("secret"), Headers: []string{"Content-Type"},
+	}, capture)}
+
+	post := func(client *http.Client, url string, header http.Header) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, url+"/invoices?draft=1", bytes.NewBufferString(`{"amount":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := post(client, server.URL, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `billing-svc:{"amount":1}`, body)
+
+	// replay the same signature
+	code, _ = post(http.DefaultClient, server.URL, http.Header{"Authorization": lastReq.Header.Values("Authorization")})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// the signed header is changed after signing
+	signer := &auth.HmacSigner{KeyID: "billing", Secret: []byte("secret"), Headers: []string{"Content-Type"}}
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/invoices", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	assert.NoError(t, signer.Sign(req))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// wrong secret
+	other := &http.Client{Transport: auth.NewHmacRoundTripper(&auth.HmacSigner{KeyID: "billing", Secret: []byte("wrong")}, nil)}
+	code, _ = post(other, server.URL, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// stale timestamp
+	stale := newServer(time.Nanosecond)
+	defer stale.Close()
+	code, _ = post(client, stale.URL, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// NewGinIntrospectionAuthMid returns a bearer auth middleware for the opaque tokens of an OAuth2
+// authorization server, the token is resolved by introspector and the scope is checked as the perms.
+func NewGinIntrospectionAuthMid(introspector TokenIntrospector, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(false, []*AuthScheme{NewIntrospectionAuthScheme(introspector)}, opts...)
+}
+
+// NewIntrospectionAuthScheme maps sub, username and scope of the active token to ReqUser.
+// The request fails closed as an invalid token when the introspection fails.
+func NewIntrospectionAuthScheme(introspector TokenIntrospector) *AuthScheme {
+	return &AuthScheme{
+		name:      AuthSchemeIntrospection,
+		challenge: "Bearer",
+		getToken:  getBearerToken,
+		loadUser:  newIntrospectionReqUserLoader(introspector),
+	}
+}
+
+func newIntrospectionReqUserLoader(introspector TokenIntrospector) reqUserLoader {
+	return func(c *gin.Context, token string) (ReqUser, error) {
+		result, err := introspector.Introspect(c.Request.Context(), token)
+		if err != nil {
+			return nil, errors.Wrap(errors.Error_Auth_Invalid_Token, err)
+		}
+		if !result.Active {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		return &reqUserImpl{
+			host:    getHost(c.Request),
+			uid:     result.Subject,
+			account: result.Username,
+			name:    result.Username,
+			roles:   result.Scopes(),
+			tokenID: result.ID,
+		}, nil
+	}
+}
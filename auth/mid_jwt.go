@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"github.com/94peter/api-toolkit/errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ClaimsKeyIssuer  = "iss"
+	ClaimsKeySubject = "sub"
+	ClaimsKeyAccount = "account"
+	ClaimsKeyName    = "name"
+	ClaimsKeyRoles   = "roles"
+	ClaimsKeyJwtID   = "jti"
+	HeaderKeyUsage   = "usa"
+)
+
+// NewGinJwtAuthMid returns a bearer auth middleware which verifies the token
+// with the JwtToken built from di and binds the ReqUser to gin and request context.
+func NewGinJwtAuthMid(di JwtDI, isMatchHost bool, opts ...BearAuthOption) GinAuthMidInter {
+	return newBearAuthMiddle(isMatchHost, []*AuthScheme{NewJwtAuthScheme(di)}, opts...)
+}
+
+// NewJwtAuthScheme verifies the bearer token with the JwtToken built from di.
+func NewJwtAuthScheme(di JwtDI) *AuthScheme {
+	return &AuthScheme{
+		name:      AuthSchemeJwt,
+		challenge: "Bearer",
+		hostBound: true,
+		getToken:  getBearerToken,
+		loadUser:  newJwtReqUserLoader(di.NewJwt()),
+	}
+}
+
+func newJwtReqUserLoader(jwtToken JwtToken) reqUserLoader {
+	return func(c *gin.Context, tokenStr string) (ReqUser, error) {
+		token, err := jwtToken.ParseToken(tokenStr)
+		if err != nil {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		// only the login tokens of GetToken, e.g. the access tokens of a shared link are rejected.
+		if usage, ok := token.Header[HeaderKeyUsage]; ok && usage != "" {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		reqUser, err := NewReqUserFromToken(token)
+		if err != nil {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		return reqUser, nil
+	}
+}
+
+// bindReqUser stores user to both gin context and the request context.
+func bindReqUser(c *gin.Context, user ReqUser) {
+	SetReqUserToGin(c, user)
+	c.Request = c.Request.WithContext(SetReqUserToCtx(c.Request.Context(), user))
+}
+
+// NewReqUserFromToken maps the standard claims of a parsed token to ReqUser.
+func NewReqUserFromToken(token *jwt.Token) (ReqUser, error) {
+	if token == nil {
+		return nil, errors.Error_Auth_Invalid_Token
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.Error_Auth_Invalid_Token
+	}
+	usage, _ := token.Header[HeaderKeyUsage].(string)
+	return &reqUserImpl{
+		host:    getStrClaim(claims, ClaimsKeyIssuer),
+		uid:     getStrClaim(claims, ClaimsKeySubject),
+		account: getStrClaim(claims, ClaimsKeyAccount),
+		name:    getStrClaim(claims, ClaimsKeyName),
+		roles:   getStrSliceClaim(claims, ClaimsKeyRoles),
+		usage:   usage,
+		tokenID: getStrClaim(claims, ClaimsKeyJwtID),
+	}, nil
+}
+
+func getStrClaim(claims jwt.MapClaims, key string) string {
+	v, _ := claims[key].(string)
+	return v
+}
+
+func getStrSliceClaim(claims jwt.MapClaims, key string) []string {
+	switch v := claims[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJwtConf(t *testing.T) *auth.JwtConf {
+	dir := t.TempDir()
+	j := &auth.JwtConf{
+		PrivateKeyFile: filepath.Join(dir, "private.pem"),
+		PublicKeyFile:  filepath.Join(dir, "public.pem"),
+		RefreshSecret:  "refresh-secret",
+	}
+	j.Header.Kid = "test-kid"
+	if err := j.GenerateRsaKeys(2048); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func testErrorHandler(c *gin.Context, err error) {
+	if apiErr, ok := err.(errors.ApiError); ok {
+		c.AbortWithStatusJSON(apiErr.GetStatus(), gin.H{"error": apiErr.Error()})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func TestGinJwtAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+
+	m := auth.NewGinJwtAuthMid(j, true)
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/users", http.MethodGet, true, []auth.ApiPerm{"admin"})
+
+	r := gin.New()
+	r.GET("/users", m.Handler(), func(c *gin.Context) {
+		u := auth.GetReqUserFromGin(c)
+		ctxUser := auth.GetReqUserFromCtx(c.Request.Context())
+		assert.Equal(t, u, ctxUser)
+		c.String(http.StatusOK, u.GetId()+":"+u.GetAccount())
+	})
+
+	newToken := func(host string, roles ...string) string {
+		token, err := j.GetToken(host, map[string]interface{}{
+			"sub":     "uid-1",
+			"account": "acc",
+			"name":    "peter",
+			"roles":   roles,
+		}, 10)
+		assert.NoError(t, err)
+		return *token
+	}
+
+	tests := []struct {
+		name            string
+		authHeader      string
+		statusCode      int
+		body            string
+		wwwAuthenticate string
+	}{
+		{name: "miss token", statusCode: http.StatusUnauthorized, wwwAuthenticate: "Bearer"},
+		{name: "invalid token", authHeader: "Bearer abc", statusCode: http.StatusUnauthorized,
+			wwwAuthenticate: `Bearer error="invalid_token", error_description="invalid token"`},
+		{name: "host not match", authHeader: "Bearer " + newToken("other.host", "admin"), statusCode: http.StatusForbidden},
+		{name: "no perm", authHeader: "Bearer " + newToken("example.com", "user"), statusCode: http.StatusForbidden,
+			wwwAuthenticate: `Bearer error="insufficient_scope", error_description="no permission"`},
+		{name: "ok", authHeader: "Bearer " + newToken("example.com", "admin"), statusCode: http.StatusOK, body: "uid-1:acc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/users", nil)
+			if tt.authHeader != "" {
+				req.Header.Set(auth.BearerAuthTokenKey, tt.authHeader)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Equal(t, tt.wwwAuthenticate, w.Header().Get(auth.HeaderWWWAuthenticate))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGinJwtAuthMidOverrideErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+
+	errExpired := errors.New(http.StatusUnauthorized, "please login again")
+	m := auth.NewGinJwtAuthMid(j, false,
+		auth.BearAuthWithRealm("api-toolkit"),
+		auth.BearAuthWithErrors(auth.AuthErrors{InvalidToken: errExpired}),
+	)
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/users", http.MethodGet, true, nil)
+
+	r := gin.New()
+	r.GET("/users", m.Handler(), func(c *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(auth.BearerAuthTokenKey, "Bearer abc")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"please login again"}`, w.Body.String())
+	assert.Equal(t, `Bearer realm="api-toolkit", error="invalid_token", error_description="please login again"`,
+		w.Header().Get(auth.HeaderWWWAuthenticate))
+}
+
+func TestGinJwtAuthMidRejectsAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+	m := auth.NewGinJwtAuthMid(j, false)
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/profile", http.MethodGet, true, nil)
+	r := gin.New()
+	r.GET("/profile", m.Handler(), func(c *gin.Context) {})
+
+	token, err := j.GetAccessToken("example.com", "order", 1, "db", "read")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set(auth.BearerAuthTokenKey, "Bearer "+*token)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	OidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	defaultOidcTimeout  = 10 * time.Second
+	maxOidcResponseSize = 1 << 20
+)
+
+// defaultOidcClient is used without OidcConf.HttpClient, so a hung provider can't block the login forever.
+var defaultOidcClient = &http.Client{Timeout: defaultOidcTimeout}
+
+var (
+	ErrIDTokenIssuer = errors.New("id token issuer not match")
+	ErrIDTokenNonce  = errors.New("id token nonce not match")
+	ErrIDTokenAtHash = errors.New("id token at_hash not match")
+	ErrIDTokenAzp    = errors.New("id token authorized party not match")
+)
+
+// OidcDiscovery is the OpenID Connect discovery document of a provider.
+type OidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint,omitempty"`
+	JwksURI               string   `json:"jwks_uri"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+	// IDTokenSigningAlgs are the id_token_signing_alg_values_supported.
+	IDTokenSigningAlgs []string `json:"id_token_signing_alg_values_supported,omitempty"`
+}
+
+// LoadOidcDiscovery fetches the discovery document of issuer, the issuer of the document must equal issuer.
+func LoadOidcDiscovery(ctx context.Context, client *http.Client, issuer string) (*OidcDiscovery, error) {
+	if client == nil {
+		client = defaultOidcClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+OidcDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetch oidc discovery fail: status %d", resp.StatusCode)
+	}
+	var doc OidcDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOidcResponseSize)).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "decode oidc discovery fail")
+	}
+	if doc.Issuer != issuer {
+		return nil, errors.Errorf("oidc discovery issuer [%s] not match [%s]", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JwksURI == "" {
+		return nil, errors.New("oidc discovery missing endpoints")
+	}
+	return &doc, nil
+}
+
+// OidcConf is the client registered at an OpenID Connect provider.
+type OidcConf struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	// Scopes are requested besides openid.
+	Scopes []string `yaml:"scopes"`
+	// Leeway is the clock skew allowed for exp, nbf and iat of the id token.
+	Leeway     time.Duration `yaml:"leeway"`
+	HttpClient *http.Client  `yaml:"-"`
+}
+
+// IDTokenClaims are the claims of an OpenID Connect id token.
+type IDTokenClaims struct {
+	RegisteredClaims
+	Nonce             string `json:"nonce,omitempty"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	AtHash            string `json:"at_hash,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// OidcTokenResponse is the response of the token endpoint.
+type OidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	IDToken      string `json:"id_token"`
+}
+
+// OidcProvider verifies the id tokens of a provider with the keys of its jwks_uri.
+type OidcProvider struct {
+	conf      OidcConf
+	discovery *OidcDiscovery
+	verifier  JwtToken
+}
+
+// NewOidcProvider loads the discovery document of conf.Issuer.
+func NewOidcProvider(ctx context.Context, conf OidcConf) (*OidcProvider, error) {
+	doc, err := LoadOidcDiscovery(ctx, conf.HttpClient, conf.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &JwksConf{
+		URL:        doc.JwksURI,
+		Algorithms: doc.IDTokenSigningAlgs,
+		Audience:   []string{conf.ClientID},
+		Leeway:     conf.Leeway,
+		HttpClient: conf.HttpClient,
+	}
+	return &OidcProvider{conf: conf, discovery: doc, verifier: jwks.NewJwt()}, nil
+}
+
+func (p *OidcProvider) Discovery() *OidcDiscovery {
+	return p.discovery
+}
+
+func (p *OidcProvider) httpClient() *http.Client {
+	if p.conf.HttpClient != nil {
+		return p.conf.HttpClient
+	}
+	return defaultOidcClient
+}
+
+// AuthCodeURL is the authorization request of the code flow with a S256 PKCE challenge.
+func (p *OidcProvider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.conf.ClientID},
+		"redirect_uri":          {p.conf.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.conf.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange redeems the authorization code with the PKCE verifier at the token endpoint.
+func (p *OidcProvider) Exchange(ctx context.Context, code, codeVerifier string) (*OidcTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.conf.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.conf.ClientSecret == "" {
+		form.Set("client_id", p.conf.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, maxOidcResponseSize)).Decode(&e)
+		return nil, errors.Errorf("exchange code fail: status %d %s %s", resp.StatusCode, e.Error, e.Description)
+	}
+	var token OidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOidcResponseSize)).Decode(&token); err != nil {
+		return nil, errors.Wrap(err, "decode token response fail")
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return &token, nil
+}
+
+// VerifyIDToken verifies the signature, exp, iss and aud of an id token.
+// The nonce must match when nonce is not empty, at_hash is checked when accessToken is not empty.
+func (p *OidcProvider) VerifyIDToken(rawIDToken, nonce, accessToken string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	token, err := parseValidToken(p.verifier.(claimsVerifier), rawIDToken, claims)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != p.discovery.Issuer {
+		return nil, ErrIDTokenIssuer
+	}
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.conf.ClientID {
+		return nil, ErrIDTokenAzp
+	}
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrIDTokenNonce
+	}
+	if accessToken != "" && claims.AtHash != "" {
+		alg, _ := token.Header["alg"].(string)
+		atHash, err := OidcTokenHash(alg, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(claims.AtHash), []byte(atHash)) != 1 {
+			return nil, ErrIDTokenAtHash
+		}
+	}
+	return claims, nil
+}
+
+// OidcTokenHash is the at_hash of token, the left half of its hash by the hash of alg in base64url.
+func OidcTokenHash(alg, token string) (string, error) {
+	var h crypto.Hash
+	switch alg {
+	case AlgRS256, AlgES256, "PS256":
+		h = crypto.SHA256
+	case "RS384", AlgES384, "PS384":
+		h = crypto.SHA384
+	case "RS512", "ES512", "PS512", AlgEdDSA:
+		h = crypto.SHA512
+	default:
+		return "", errors.Errorf("unsupported at_hash alg [%s]", alg)
+	}
+	hh := h.New()
+	hh.Write([]byte(token))
+	sum := hh.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// NewPkceVerifier returns a random RFC 7636 code verifier.
+func NewPkceVerifier() (string, error) {
+	return randomURLString(32)
+}
+
+// PkceChallenge is the S256 code challenge of verifier.
+func PkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
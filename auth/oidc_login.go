@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/subtle"
+	stderrors "errors"
+	"net/http"
+	"sync"
+	"time"
+
+	apierrors "github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultOidcStateCookie = "oidc_state"
+	oidcStateLifetime      = 10 * time.Minute
+)
+
+var ErrOidcStateNotFound = errors.New("oidc state not found")
+
+// OidcLoginState is kept between the login redirect and the callback.
+type OidcLoginState struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// OidcStateStore keeps the pending logins by state, implement it with a shared
+// backend (e.g. redis) when the service runs more than one instance.
+type OidcStateStore interface {
+	Save(state string, s *OidcLoginState) error
+	// Pop returns and removes the state, ErrOidcStateNotFound if it's unknown or expired.
+	Pop(state string) (*OidcLoginState, error)
+}
+
+// NewMemoryOidcStateStore keeps the states in memory, the expired states are dropped on Save.
+func NewMemoryOidcStateStore() OidcStateStore {
+	return &memoryOidcStateStore{states: make(map[string]*OidcLoginState)}
+}
+
+type memoryOidcStateStore struct {
+	lock   sync.Mutex
+	states map[string]*OidcLoginState
+}
+
+func (s *memoryOidcStateStore) Save(state string, ls *OidcLoginState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for k, v := range s.states {
+		if !now.Before(v.ExpiresAt) {
+			delete(s.states, k)
+		}
+	}
+	st := *ls
+	s.states[state] = &st
+	return nil
+}
+
+func (s *memoryOidcStateStore) Pop(state string) (*OidcLoginState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ls, ok := s.states[state]
+	delete(s.states, state)
+	if !ok || !time.Now().Before(ls.ExpiresAt) {
+		return nil, ErrOidcStateNotFound
+	}
+	return ls, nil
+}
+
+// OidcLoginConf mints the tokens of Jwt for the users logged in at Provider.
+type OidcLoginConf struct {
+	Provider *OidcProvider
+	Jwt      JwtDI
+	// States is a memory store by default.
+	States OidcStateStore
+	// StateCookie binds the state to the browser starting the login, the default is oidc_state.
+	StateCookie string
+	// TokenExp is the exp minutes of GetTokenWithRefresh.
+	TokenExp uint8
+	// MapClaims maps the verified id token to the token data, the default maps sub, account and name.
+	// An ApiError it returns is responded as is, the other errors as errors.Error_Auth_No_Perm.
+	MapClaims func(c *gin.Context, claims *IDTokenClaims) (map[string]interface{}, error)
+	// OnLogin writes the response, the default writes the Token in json.
+	OnLogin func(c *gin.Context, token *Token, claims *IDTokenClaims)
+	// ErrorHandler responds the failed logins, e.g. the handler of errors.NewProblemErrorHandler.
+	// The default writes the status of the ApiError and its message in json.
+	ErrorHandler apierrors.GinApiErrorHandler
+}
+
+// OidcLogin provides the handlers of the authorization code flow with PKCE, e.g.
+//
+//	login := auth.NewOidcLogin(auth.OidcLoginConf{Provider: provider, Jwt: jwtConf})
+//	{Method: "GET", Path: "/login", Handler: login.LoginHandler()},
+//	{Method: "GET", Path: "/callback", Handler: login.CallbackHandler()},
+type OidcLogin struct {
+	conf OidcLoginConf
+}
+
+func NewOidcLogin(conf OidcLoginConf) *OidcLogin {
+	if conf.States == nil {
+		conf.States = NewMemoryOidcStateStore()
+	}
+	if conf.StateCookie == "" {
+		conf.StateCookie = DefaultOidcStateCookie
+	}
+	if conf.MapClaims == nil {
+		conf.MapClaims = defaultOidcMapClaims
+	}
+	if conf.OnLogin == nil {
+		conf.OnLogin = func(c *gin.Context, token *Token, _ *IDTokenClaims) {
+			c.JSON(http.StatusOK, token)
+		}
+	}
+	if conf.ErrorHandler == nil {
+		conf.ErrorHandler = defaultOidcErrorHandler
+	}
+	return &OidcLogin{conf: conf}
+}
+
+// defaultOidcErrorHandler hides the text of the server errors.
+func defaultOidcErrorHandler(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var apiErr apierrors.ApiError
+	if stderrors.As(err, &apiErr) {
+		status = apiErr.GetStatus()
+	}
+	msg := http.StatusText(status)
+	if status < http.StatusInternalServerError {
+		msg = err.Error()
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": msg})
+}
+
+func (l *OidcLogin) abort(c *gin.Context, err error) {
+	l.conf.ErrorHandler(c, err)
+	c.Abort()
+}
+
+func defaultOidcMapClaims(_ *gin.Context, claims *IDTokenClaims) (map[string]interface{}, error) {
+	account := claims.Email
+	if account == "" {
+		account = claims.PreferredUsername
+	}
+	return map[string]interface{}{
+		ClaimsKeySubject: claims.Subject,
+		ClaimsKeyAccount: account,
+		ClaimsKeyName:    claims.Name,
+	}, nil
+}
+
+// LoginHandler redirects to the authorization endpoint of the provider.
+func (l *OidcLogin) LoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, err := randomURLString(24)
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		nonce, err := randomURLString(24)
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		verifier, err := NewPkceVerifier()
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		err = l.conf.States.Save(state, &OidcLoginState{
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcStateLifetime),
+		})
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		l.setStateCookie(c, state, int(oidcStateLifetime.Seconds()))
+		c.Redirect(http.StatusFound, l.conf.Provider.AuthCodeURL(state, nonce, PkceChallenge(verifier)))
+	}
+}
+
+// CallbackHandler checks the state, exchanges the code, verifies the id token
+// and responds the tokens of GetTokenWithRefresh by OnLogin.
+func (l *OidcLogin) CallbackHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := c.Query("state")
+		cookie, _ := c.Cookie(l.conf.StateCookie)
+		l.setStateCookie(c, "", -1)
+		if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+			l.abort(c, apierrors.Error_Auth_Invalid_State)
+			return
+		}
+		ls, err := l.conf.States.Pop(state)
+		if stderrors.Is(err, ErrOidcStateNotFound) {
+			l.abort(c, apierrors.Error_Auth_Invalid_State)
+			return
+		}
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		if authErr := c.Query("error"); authErr != "" {
+			l.abort(c, apierrors.Wrap(apierrors.Error_Auth_Miss_Token, errors.Errorf("authorization error [%s]", authErr)))
+			return
+		}
+		code := c.Query("code")
+		if code == "" {
+			l.abort(c, apierrors.Error_Auth_Miss_Token)
+			return
+		}
+		resp, err := l.conf.Provider.Exchange(c.Request.Context(), code, ls.CodeVerifier)
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusBadGateway, err))
+			return
+		}
+		claims, err := l.conf.Provider.VerifyIDToken(resp.IDToken, ls.Nonce, resp.AccessToken)
+		if err != nil {
+			l.abort(c, apierrors.Wrap(apierrors.Error_Auth_Invalid_Token, err))
+			return
+		}
+		data, err := l.conf.MapClaims(c, claims)
+		if err != nil {
+			var apiErr apierrors.ApiError
+			if !stderrors.As(err, &apiErr) {
+				apiErr = apierrors.Wrap(apierrors.Error_Auth_No_Perm, err)
+			}
+			l.abort(c, apiErr)
+			return
+		}
+		token, err := l.conf.Jwt.NewJwt().GetTokenWithRefresh(getHost(c.Request), data, l.conf.TokenExp)
+		if err != nil {
+			l.abort(c, apierrors.PkgError(http.StatusInternalServerError, err))
+			return
+		}
+		l.conf.OnLogin(c, token, claims)
+	}
+}
+
+func (l *OidcLogin) setStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(l.conf.StateCookie, state, maxAge, "/", "", secure, true)
+}
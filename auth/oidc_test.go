@@ -0,0 +1,213 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/auth/oidctest"
+	"github.com/94peter/api-toolkit/errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOidcProvider(t *testing.T) (*oidctest.Provider, *auth.OidcProvider) {
+	fake, err := oidctest.NewProvider("app", "app-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+	p, err := auth.NewOidcProvider(context.Background(), auth.OidcConf{
+		Issuer:       fake.Issuer(),
+		ClientID:     "app",
+		ClientSecret: "app-secret",
+		RedirectURL:  "http://app.test/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, p
+}
+
+func TestOidcProviderVerifyIDToken(t *testing.T) {
+	fake, p := newTestOidcProvider(t)
+	assert.Equal(t, fake.URL+"/token", p.Discovery().TokenEndpoint)
+
+	_, err := auth.LoadOidcDiscovery(context.Background(), nil, fake.Issuer()+"/other")
+	assert.Error(t, err)
+
+	now := time.Now()
+	atHash, err := auth.OidcTokenHash(auth.AlgRS256, "access-1")
+	assert.NoError(t, err)
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": fake.Issuer(), "aud": "app", "sub": "u1", "nonce": "n1", "at_hash": atHash,
+			"iat": now.Unix(), "exp": now.Add(time.Hour).Unix(), "email": "u1@example.com",
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(c map[string]interface{})
+		err    error
+	}{
+		{name: "valid", modify: func(c map[string]interface{}) {}},
+		{name: "issuer", modify: func(c map[string]interface{}) { c["iss"] = "https://evil.test" }, err: auth.ErrIDTokenIssuer},
+		{name: "audience", modify: func(c map[string]interface{}) { c["aud"] = "other" }, err: auth.ErrTokenAudience},
+		{name: "azp", modify: func(c map[string]interface{}) { c["aud"] = []string{"app", "other"} }, err: auth.ErrIDTokenAzp},
+		{name: "nonce", modify: func(c map[string]interface{}) { c["nonce"] = "n2" }, err: auth.ErrIDTokenNonce},
+		{name: "at_hash", modify: func(c map[string]interface{}) { c["at_hash"] = "x" }, err: auth.ErrIDTokenAtHash},
+		{name: "expired", modify: func(c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() }, err: auth.ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			raw, err := fake.SignIDToken(c)
+			assert.NoError(t, err)
+			claims, err := p.VerifyIDToken(raw, "n1", "access-1")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "u1", claims.Subject)
+			assert.Equal(t, "u1@example.com", claims.Email)
+		})
+	}
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(valid()))
+	raw, err := forged.SignedString([]byte("secret"))
+	assert.NoError(t, err)
+	_, err = p.VerifyIDToken(raw, "n1", "")
+	assert.Error(t, err)
+}
+
+func TestLoadOidcDiscoveryBodyLimit(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"issuer":"` + server.URL + `","authorization_endpoint":"a","token_endpoint":"t",` +
+			`"jwks_uri":"j","pad":"` + strings.Repeat("a", 2<<20) + `"}`))
+	}))
+	defer server.Close()
+
+	_, err := auth.LoadOidcDiscovery(context.Background(), nil, server.URL)
+	assert.Error(t, err)
+}
+
+func TestOidcLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake, err := oidctest.NewProvider("app", "app-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	fake.Claims = map[string]interface{}{"sub": "u1", "email": "u1@example.com", "name": "User One"}
+	j := newTestJwtConf(t)
+
+	r := gin.New()
+	app := httptest.NewServer(r)
+	defer app.Close()
+	p, err := auth.NewOidcProvider(context.Background(), auth.OidcConf{
+		Issuer:       fake.Issuer(),
+		ClientID:     "app",
+		ClientSecret: "app-secret",
+		RedirectURL:  app.URL + "/callback",
+		Scopes:       []string{"email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lastErr error
+	login := auth.NewOidcLogin(auth.OidcLoginConf{Provider: p, Jwt: j,
+		ErrorHandler: func(c *gin.Context, err error) {
+			lastErr = err
+			testErrorHandler(c, err)
+		}})
+	r.GET("/login", login.LoginHandler())
+	r.GET("/callback", login.CallbackHandler())
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(app.URL + "/login")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var token auth.Token
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&token))
+	assert.NotEmpty(t, token.RefreshToken)
+	parsed, err := j.ParseToken(token.AccessToken)
+	assert.NoError(t, err)
+	user, err := auth.NewReqUserFromToken(parsed)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", user.GetId())
+	assert.Equal(t, "u1@example.com", user.GetAccount())
+	assert.Equal(t, "User One", user.GetName())
+
+	noRedirect := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err = noRedirect.Get(app.URL + "/login")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	resp, err = noRedirect.Get(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	callback := resp.Header.Get("Location")
+
+	resp, err = http.Get(callback)
+	assert.NoError(t, err)
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "state cookie is required")
+	assert.Equal(t, "invalid login state", body["error"])
+	assert.ErrorIs(t, lastErr, errors.Error_Auth_Invalid_State)
+
+	resp, err = noRedirect.Get(callback)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	u, _ := url.Parse(app.URL)
+	cb, _ := url.Parse(callback)
+	jar.SetCookies(u, []*http.Cookie{{Name: auth.DefaultOidcStateCookie, Value: cb.Query().Get("state"), Path: "/"}})
+	lastErr = nil
+	resp, err = noRedirect.Get(callback)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "state is used once")
+	assert.ErrorIs(t, lastErr, errors.Error_Auth_Invalid_State)
+
+	resp, err = noRedirect.Get(app.URL + "/login")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	state, _ := url.Parse(resp.Header.Get("Location"))
+	resp, err = noRedirect.Get(app.URL + "/callback?error=access_denied&state=" + state.Query().Get("state"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.ErrorIs(t, lastErr, errors.Error_Auth_Miss_Token)
+}
+
+func TestOidcLoginDefaultErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, p := newTestOidcProvider(t)
+	login := auth.NewOidcLogin(auth.OidcLoginConf{Provider: p, Jwt: newTestJwtConf(t)})
+	r := gin.New()
+	r.GET("/callback", login.CallbackHandler())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/callback?state=s1", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid login state"}`, w.Body.String())
+}
@@ -0,0 +1,166 @@
+// Package oidctest provides a local OpenID Connect provider for the tests of the auth login flow.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const kid = "oidctest"
+
+// Provider serves discovery, jwks, authorize and token endpoints. The authorize endpoint
+// approves every request as the user of Claims and redirects back with a code.
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Claims are added to the issued id tokens, e.g. sub and email.
+	Claims map[string]interface{}
+
+	key   *rsa.PrivateKey
+	lock  sync.Mutex
+	codes map[string]authCode
+}
+
+type authCode struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// NewProvider starts a provider, call Close when done.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Claims:       map[string]interface{}{"sub": "user-1"},
+		key:          key,
+		codes:        make(map[string]authCode),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(auth.OidcDiscoveryPath, p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Issuer is the issuer of the discovery document and the id tokens.
+func (p *Provider) Issuer() string {
+	return p.URL
+}
+
+// SignIDToken signs claims as an id token, the tests use it to build invalid tokens.
+func (p *Provider) SignIDToken(claims map[string]interface{}) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = kid
+	return token.SignedString(p.key)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.OidcDiscovery{
+		Issuer:                p.Issuer(),
+		AuthorizationEndpoint: p.URL + "/authorize",
+		TokenEndpoint:         p.URL + "/token",
+		JwksURI:               p.URL + "/jwks",
+		IDTokenSigningAlgs:    []string{auth.AlgRS256},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{auth.NewRsaJWK(kid, &p.key.PublicKey)}})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	p.lock.Lock()
+	p.codes[code] = authCode{redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	p.lock.Unlock()
+	rq := redirectURI.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirectURI.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostFormValue("client_id")
+	}
+	if id != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	p.lock.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.lock.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != code.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	accessToken := randomString()
+	atHash, _ := auth.OidcTokenHash(auth.AlgRS256, accessToken)
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":     p.Issuer(),
+		"aud":     p.ClientID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+		"nonce":   code.nonce,
+		"at_hash": atHash,
+	}
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+	idToken, err := p.SignIDToken(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, auth.OidcTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+		IDToken:     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
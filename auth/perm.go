@@ -18,6 +18,8 @@ type reqUserImpl struct {
 	name    string
 	roles   []string
 	usage   string
+	tokenID string
+	scheme  string
 }
 
 func (u *reqUserImpl) GetHost() string {
@@ -43,3 +45,11 @@ func (u *reqUserImpl) GetName() string {
 func (u *reqUserImpl) GetUsage() string {
 	return u.usage
 }
+
+func (u *reqUserImpl) GetTokenID() string {
+	return u.tokenID
+}
+
+func (u *reqUserImpl) GetAuthScheme() string {
+	return u.scheme
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"strings"
+)
+
+const (
+	PermWildcard  = "*"
+	permSeparator = ":"
+
+	// MethodAnyPerm is the method of AddAuthPath and PermRule matching every method.
+	MethodAnyPerm = "*"
+)
+
+// MatchPerm reports whether the granted permission satisfies the required one.
+// Permissions are ":" separated segments, a "*" segment of granted matches one segment,
+// a trailing "*" matches the rest, e.g. orders:* matches orders:read and orders:items:write.
+func MatchPerm(granted, required string) bool {
+	if granted == required || granted == PermWildcard {
+		return true
+	}
+	gs := strings.Split(granted, permSeparator)
+	rs := strings.Split(required, permSeparator)
+	for i, g := range gs {
+		if i >= len(rs) {
+			return false
+		}
+		if g == PermWildcard {
+			if i == len(gs)-1 {
+				return true
+			}
+			continue
+		}
+		if g != rs[i] {
+			return false
+		}
+	}
+	return len(gs) == len(rs)
+}
+
+// RolePerms maps a role to the permissions it grants.
+type RolePerms map[string][]ApiPerm
+
+// Expand returns the roles with the permissions they grant.
+func (rp RolePerms) Expand(roles []string) []string {
+	if len(rp) == 0 {
+		return roles
+	}
+	result := append([]string{}, roles...)
+	for _, role := range roles {
+		for _, p := range rp[role] {
+			result = append(result, string(p))
+		}
+	}
+	return result
+}
+
+// PermRule requires one of Perms for the requests matching Path and Method.
+// Path ending with "/*" matches the prefix, an empty or "*" Method matches every method.
+// The rules are checked only on the Auth routes, the server panics when a rule matches a route without Auth.
+type PermRule struct {
+	Path   string
+	Method string
+	Perms  []ApiPerm
+}
+
+func (r PermRule) match(path, method string) bool {
+	if r.Method != "" && r.Method != MethodAnyPerm && r.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(r.Path, "/*"); ok {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return r.Path == path
+}
+
+// hasAnyPerm reports whether granted satisfies one of required, an empty required always passes.
+func hasAnyPerm(required []ApiPerm, granted []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+	for _, r := range required {
+		for _, g := range granted {
+			if MatchPerm(g, string(r)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BearAuthWithRolePerms grants the permissions of the user's roles before the permission check.
+func BearAuthWithRolePerms(rolePerms RolePerms) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.rolePerms = rolePerms
+	}
+}
+
+// BearAuthWithPermRules adds path pattern rules, the user must satisfy the route group and every matched rule.
+func BearAuthWithPermRules(rules ...PermRule) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.permRules = append(m.permRules, rules...)
+	}
+}
+
+// GinPermRuleAuthMidInter is an auth middleware checking PermRules.
+type GinPermRuleAuthMidInter interface {
+	GinAuthMidInter
+	// HasPermRule reports whether a PermRule matches the route.
+	HasPermRule(path, method string) bool
+}
+
+func (am *bearAuthMiddle) HasPermRule(path, method string) bool {
+	for _, rule := range am.permRules {
+		if rule.match(path, method) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPerm(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		want              bool
+	}{
+		{"admin", "admin", true},
+		{"*", "orders:read", true},
+		{"orders:*", "orders:read", true},
+		{"orders:*", "orders:items:write", true},
+		{"orders:*", "orders", false},
+		{"orders:*:read", "orders:items:read", true},
+		{"orders:*:read", "orders:items:write", false},
+		{"orders:read", "orders:write", false},
+		{"orders:read", "orders:read:all", false},
+		{"users:*", "orders:read", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, auth.MatchPerm(tt.granted, tt.required), "%s -> %s", tt.granted, tt.required)
+	}
+}
+
+func TestBearAuthHasPerm(t *testing.T) {
+	m := auth.NewGinBearAuthMid(false,
+		auth.BearAuthWithRolePerms(auth.RolePerms{
+			"admin":  {"orders:*", "users:*"},
+			"viewer": {"orders:read"},
+		}),
+		auth.BearAuthWithPermRules(
+			auth.PermRule{Path: "/admin/*", Perms: []auth.ApiPerm{"admin:access"}},
+		),
+	)
+	m.AddAuthPath("/orders", http.MethodGet, true, []auth.ApiPerm{"orders:read"})
+	m.AddAuthPath("/orders", http.MethodDelete, true, []auth.ApiPerm{"orders:delete"})
+	m.AddAuthPath("/admin/users", auth.MethodAnyPerm, true, nil)
+
+	assert.True(t, m.HasPerm("/orders", http.MethodGet, []string{"viewer"}))
+	assert.False(t, m.HasPerm("/orders", http.MethodDelete, []string{"viewer"}))
+	assert.True(t, m.HasPerm("/orders", http.MethodDelete, []string{"admin"}))
+	assert.True(t, m.HasPerm("/orders", http.MethodGet, []string{"orders:read"}))
+
+	assert.True(t, m.IsAuth("/admin/users", http.MethodPost))
+	assert.False(t, m.HasPerm("/admin/users", http.MethodPost, []string{"admin"}))
+	assert.True(t, m.HasPerm("/admin/users", http.MethodPost, []string{"admin", "admin:*"}))
+}
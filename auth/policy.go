@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PolicyEffectAllow = "allow"
+	PolicyEffectDeny  = "deny"
+)
+
+// PolicySet is the policy file format of NewPolicyAuthorizer, e.g.
+//
+//	{
+//	  "default": "deny",
+//	  "policies": [{
+//	    "name": "owner-only",
+//	    "effect": "allow",
+//	    "paths": ["/v1/users/:id"],
+//	    "methods": ["GET", "PUT"],
+//	    "conditions": ["param.id == user.id", "time.hour >= 9", "time.hour < 18"]
+//	  }]
+//	}
+//
+// A policy applies when the route path and method match (empty matches all) and all conditions are true.
+// Any applied deny policy denies the request, otherwise any applied allow policy allows it,
+// otherwise the default effect is used.
+//
+// A condition is "<operand> <op> <operand>", op is one of ==, !=, <, <=, >, >=, in, contains.
+// An operand is a quoted string, a number or an attribute: user.id, user.account, user.name,
+// user.host, user.usage, user.perms, param.<name>, query.<name>, header.<name>, method, path,
+// time.hour, time.minute, time.weekday (0 is Sunday) and time.unix.
+// A condition of a deny policy is true when its attribute is absent, e.g. the header is not sent,
+// so a deny policy fails closed. A comparison of a multi value attribute, e.g. a repeated query,
+// or in, is true when any value matches in a deny policy and when every value matches in an allow policy.
+type PolicySet struct {
+	Default  string   `json:"default"`
+	Policies []Policy `json:"policies"`
+	// Timezone is the IANA location of the time attributes, the default is UTC.
+	Timezone string `json:"timezone"`
+}
+
+type Policy struct {
+	Name       string   `json:"name"`
+	Effect     string   `json:"effect"`
+	Paths      []string `json:"paths"`
+	Methods    []string `json:"methods"`
+	Conditions []string `json:"conditions"`
+}
+
+// LoadPolicyFile reads a json PolicySet file and returns its Authorizer.
+func LoadPolicyFile(file string) (Authorizer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var set PolicySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return NewPolicyAuthorizer(set)
+}
+
+// NewPolicyAuthorizer compiles the conditions of set, it returns an error on an invalid policy.
+func NewPolicyAuthorizer(set PolicySet) (Authorizer, error) {
+	a := &policyAuthorizer{defaultAllow: set.Default == PolicyEffectAllow, location: time.UTC}
+	if set.Default != "" && set.Default != PolicyEffectAllow && set.Default != PolicyEffectDeny {
+		return nil, fmt.Errorf("invalid default effect [%s]", set.Default)
+	}
+	if set.Timezone != "" {
+		loc, err := time.LoadLocation(set.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone [%s]: %w", set.Timezone, err)
+		}
+		a.location = loc
+	}
+	for _, p := range set.Policies {
+		if p.Effect != PolicyEffectAllow && p.Effect != PolicyEffectDeny {
+			return nil, fmt.Errorf("policy [%s]: invalid effect [%s]", p.Name, p.Effect)
+		}
+		cp := compiledPolicy{Policy: p}
+		for _, cond := range p.Conditions {
+			c, err := parseCondition(cond)
+			if err != nil {
+				return nil, fmt.Errorf("policy [%s]: %w", p.Name, err)
+			}
+			cp.conditions = append(cp.conditions, c)
+		}
+		a.policies = append(a.policies, cp)
+	}
+	return a, nil
+}
+
+type policyAuthorizer struct {
+	defaultAllow bool
+	location     *time.Location
+	policies     []compiledPolicy
+}
+
+func (a *policyAuthorizer) Authorize(ctx context.Context, req *AuthzRequest) (AuthzDecision, error) {
+	var allowed *compiledPolicy
+	r := *req
+	r.Time = req.Time.In(a.location)
+	req = &r
+	for i := range a.policies {
+		p := &a.policies[i]
+		if !p.applies(req) {
+			continue
+		}
+		if p.Effect == PolicyEffectDeny {
+			return AuthzDecision{Allow: false, Policy: p.Name, Reason: "denied by policy"}, nil
+		}
+		if allowed == nil {
+			allowed = p
+		}
+	}
+	if allowed != nil {
+		return AuthzDecision{Allow: true, Policy: allowed.Name, Reason: "allowed by policy"}, nil
+	}
+	return AuthzDecision{Allow: a.defaultAllow, Reason: "default"}, nil
+}
+
+type compiledPolicy struct {
+	Policy
+	conditions []condition
+}
+
+func (p *compiledPolicy) applies(req *AuthzRequest) bool {
+	if len(p.Paths) > 0 && !isStrInList(req.Path, p.Paths...) {
+		return false
+	}
+	if len(p.Methods) > 0 && !isStrInList(req.Method, p.Methods...) {
+		return false
+	}
+	for _, c := range p.conditions {
+		if !c.eval(req, p.Effect == PolicyEffectDeny) {
+			return false
+		}
+	}
+	return true
+}
+
+type operand struct {
+	literal []string
+	attr    string
+}
+
+func (o operand) values(req *AuthzRequest) ([]string, bool) {
+	if o.attr == "" {
+		return o.literal, true
+	}
+	return attrValues(req, o.attr)
+}
+
+type condition struct {
+	left, right operand
+	op          string
+}
+
+// conditionOps are ordered by length, so the longest op matches at a position.
+var conditionOps = []string{" contains ", " in ", "==", "!=", "<=", ">=", "<", ">"}
+
+// parseCondition splits expr at the leftmost op outside the quoted strings.
+func parseCondition(expr string) (condition, error) {
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		switch ch := expr[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		case ch == '\'' || ch == '"':
+			quote = ch
+			continue
+		}
+		for _, op := range conditionOps {
+			if !strings.HasPrefix(expr[i:], op) {
+				continue
+			}
+			left, err := parseOperand(expr[:i])
+			if err != nil {
+				return condition{}, err
+			}
+			right, err := parseOperand(expr[i+len(op):])
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{left: left, right: right, op: strings.TrimSpace(op)}, nil
+		}
+	}
+	return condition{}, fmt.Errorf("invalid condition [%s]", expr)
+}
+
+func parseOperand(s string) (operand, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return operand{}, fmt.Errorf("missing operand")
+	}
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return operand{literal: []string{s[1 : len(s)-1]}}, nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return operand{literal: []string{s}}, nil
+	}
+	switch prefix, _, _ := strings.Cut(s, "."); prefix {
+	case "user", "param", "query", "header", "time", "method", "path":
+		return operand{attr: s}, nil
+	}
+	return operand{}, fmt.Errorf("unknown operand [%s]", s)
+}
+
+// attrValues returns the values of attr, false if the attribute is absent in req.
+func attrValues(req *AuthzRequest, attr string) ([]string, bool) {
+	prefix, name, _ := strings.Cut(attr, ".")
+	single := func(v string) ([]string, bool) { return []string{v}, true }
+	switch prefix {
+	case "method":
+		return single(req.Method)
+	case "path":
+		return single(req.Path)
+	case "param":
+		if v, ok := req.Params[name]; ok {
+			return single(v)
+		}
+	case "query":
+		if v, ok := req.Query[name]; ok {
+			return v, true
+		}
+	case "header":
+		if v := req.Header.Values(name); len(v) > 0 {
+			return v, true
+		}
+	case "time":
+		switch name {
+		case "hour":
+			return single(strconv.Itoa(req.Time.Hour()))
+		case "minute":
+			return single(strconv.Itoa(req.Time.Minute()))
+		case "weekday":
+			return single(strconv.Itoa(int(req.Time.Weekday())))
+		case "unix":
+			return single(strconv.FormatInt(req.Time.Unix(), 10))
+		}
+	case "user":
+		if req.User == nil {
+			return nil, false
+		}
+		switch name {
+		case "id":
+			return single(req.User.GetId())
+		case "account":
+			return single(req.User.GetAccount())
+		case "name":
+			return single(req.User.GetName())
+		case "host":
+			return single(req.User.GetHost())
+		case "usage":
+			return single(req.User.GetUsage())
+		case "perms":
+			return req.User.GetPerms(), true
+		}
+	}
+	return nil, false
+}
+
+// eval returns deny when an attribute of the condition is absent, a comparison of multi values
+// matches when any pair matches for deny and when every pair matches otherwise.
+func (c condition) eval(req *AuthzRequest, deny bool) bool {
+	left, okLeft := c.left.values(req)
+	right, okRight := c.right.values(req)
+	if !okLeft || !okRight || len(left) == 0 || len(right) == 0 {
+		return deny
+	}
+	switch c.op {
+	case "in":
+		for _, l := range left {
+			if isStrInList(l, right...) == deny {
+				return deny
+			}
+		}
+		return !deny
+	case "contains":
+		for _, r := range right {
+			if isStrInList(r, left...) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, l := range left {
+		for _, r := range right {
+			if compareOp(c.op, l, r) == deny {
+				return deny
+			}
+		}
+	}
+	return !deny
+}
+
+func compareOp(op, a, b string) bool {
+	cmp := compareValue(a, b)
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareValue compares numerically when both values are numbers.
+func compareValue(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,211 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicyFile = `{
+  "default": "deny",
+  "policies": [
+    {
+      "name": "owner",
+      "effect": "allow",
+      "paths": ["/v1/users/:id"],
+      "conditions": ["param.id == user.id"]
+    },
+    {
+      "name": "admin",
+      "effect": "allow",
+      "conditions": ["user.perms contains 'admin'"]
+    },
+    {
+      "name": "blocked-tenant",
+      "effect": "deny",
+      "conditions": ["header.X-Tenant-Id in 'blocked'"]
+    }
+  ]
+}`
+
+func TestPolicyAuthorizer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(file, []byte(testPolicyFile), 0600))
+	authorizer, err := auth.LoadPolicyFile(file)
+	assert.NoError(t, err)
+
+	var logs bytes.Buffer
+	m := auth.NewGinBearAuthMid(false,
+		auth.BearAuthWithAuthorizer(authorizer),
+		auth.BearAuthWithDecisionLogger(auth.NewDecisionLogger(&logs)),
+	)
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/v1/users/:id", http.MethodGet, true, nil)
+
+	r := gin.New()
+	r.GET("/v1/users/:id", func(c *gin.Context) {
+		auth.SetReqUserToGin(c, auth.NewReqUser("", c.GetHeader("X-Uid"), "acc", "name",
+			[]string{c.GetHeader("X-Role")}, ""))
+	}, m.Handler(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		uid, role  string
+		tenant     string
+		statusCode int
+	}{
+		{name: "owner", uid: "u1", statusCode: http.StatusOK},
+		{name: "other user", uid: "u2", statusCode: http.StatusForbidden},
+		{name: "admin", uid: "u2", role: "admin", statusCode: http.StatusOK},
+		{name: "blocked tenant", uid: "u1", tenant: "blocked", statusCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/v1/users/u1", nil)
+			req.Header.Set(auth.BearerAuthTokenKey, "Bearer token")
+			req.Header.Set("X-Uid", tt.uid)
+			req.Header.Set("X-Role", tt.role)
+			req.Header.Set("X-Tenant-Id", tt.tenant)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(bytes.Split(logs.Bytes(), []byte("\n"))[0], &entry))
+	assert.Equal(t, "owner", entry["policy"])
+	assert.Equal(t, true, entry["allow"])
+}
+
+func TestPolicyTimeWindow(t *testing.T) {
+	authorizer, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+		Policies: []auth.Policy{{
+			Name: "office-hours", Effect: auth.PolicyEffectAllow,
+			Conditions: []string{"time.hour >= 9", "time.hour < 18"},
+		}},
+	})
+	assert.NoError(t, err)
+	at := func(hour int) bool {
+		d, err := authorizer.Authorize(context.Background(), &auth.AuthzRequest{Time: time.Date(2024, 1, 1, hour, 0, 0, 0, time.UTC)})
+		assert.NoError(t, err)
+		return d.Allow
+	}
+	assert.True(t, at(9))
+	assert.False(t, at(18))
+	assert.False(t, at(3))
+
+	_, err = auth.NewPolicyAuthorizer(auth.PolicySet{
+		Policies: []auth.Policy{{Name: "bad", Effect: auth.PolicyEffectAllow, Conditions: []string{"foo.bar == 1"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestPolicyConditionParse(t *testing.T) {
+	authorize := func(cond string, req *auth.AuthzRequest) bool {
+		authorizer, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+			Policies: []auth.Policy{{Name: "p", Effect: auth.PolicyEffectAllow, Conditions: []string{cond}}},
+		})
+		assert.NoError(t, err, cond)
+		d, err := authorizer.Authorize(context.Background(), req)
+		assert.NoError(t, err)
+		return d.Allow
+	}
+	req := &auth.AuthzRequest{
+		Method: http.MethodGet,
+		Query:  map[string][]string{"q": {"a==b"}, "n": {"5"}},
+		Header: http.Header{},
+	}
+	assert.True(t, authorize("method != 'POST'", req))
+	assert.False(t, authorize("method != 'GET'", req))
+	assert.True(t, authorize("query.q == 'a==b'", req))
+	assert.True(t, authorize("'a==b' != query.n", req))
+	assert.True(t, authorize("query.n <= 5", req))
+	assert.False(t, authorize("query.n < 5", req))
+	assert.True(t, authorize("'x in y' != query.q", req))
+
+	_, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+		Policies: []auth.Policy{{Name: "bad", Effect: auth.PolicyEffectAllow, Conditions: []string{"'a == b'"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestPolicyDenyAbsentAttribute(t *testing.T) {
+	authorizer, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+		Default: auth.PolicyEffectAllow,
+		Policies: []auth.Policy{
+			{Name: "tenant", Effect: auth.PolicyEffectDeny, Conditions: []string{"header.X-Tenant-Id != user.host"}},
+			{Name: "debug", Effect: auth.PolicyEffectAllow, Conditions: []string{"query.debug == 'true'"}},
+		},
+	})
+	assert.NoError(t, err)
+	user := auth.NewReqUser("t1", "u1", "acc", "name", nil, "")
+	decide := func(header http.Header) auth.AuthzDecision {
+		d, err := authorizer.Authorize(context.Background(), &auth.AuthzRequest{User: user, Header: header})
+		assert.NoError(t, err)
+		return d
+	}
+	assert.True(t, decide(http.Header{"X-Tenant-Id": {"t1"}}).Allow)
+	assert.False(t, decide(http.Header{"X-Tenant-Id": {"t2"}}).Allow)
+	d := decide(http.Header{})
+	assert.False(t, d.Allow, "absent attribute matches the deny policy")
+	assert.Equal(t, "tenant", d.Policy)
+}
+
+func TestPolicyMultiValueAttribute(t *testing.T) {
+	authorizer, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+		Default: auth.PolicyEffectDeny,
+		Policies: []auth.Policy{
+			{Name: "block a", Effect: auth.PolicyEffectDeny, Conditions: []string{"query.x == 'a'"}},
+			{Name: "allow b c", Effect: auth.PolicyEffectAllow, Conditions: []string{"query.y in user.perms"}},
+		},
+	})
+	assert.NoError(t, err)
+	user := auth.NewReqUser("", "u1", "acc", "name", []string{"b", "c"}, "")
+	decide := func(query url.Values) auth.AuthzDecision {
+		d, err := authorizer.Authorize(context.Background(), &auth.AuthzRequest{User: user, Query: query})
+		assert.NoError(t, err)
+		return d
+	}
+	assert.True(t, decide(url.Values{"x": {"b"}, "y": {"b", "c"}}).Allow)
+	d := decide(url.Values{"x": {"a", "b"}, "y": {"b"}})
+	assert.False(t, d.Allow, "a repeated value can't bypass the deny policy")
+	assert.Equal(t, "block a", d.Policy)
+	assert.False(t, decide(url.Values{"x": {"b"}, "y": {"b", "d"}}).Allow, "every value must match the allow policy")
+}
+
+func TestPolicyTimezone(t *testing.T) {
+	newAuthorizer := func(tz string) auth.Authorizer {
+		authorizer, err := auth.NewPolicyAuthorizer(auth.PolicySet{
+			Timezone: tz,
+			Policies: []auth.Policy{{Name: "morning", Effect: auth.PolicyEffectAllow, Conditions: []string{"time.hour == 9"}}},
+		})
+		assert.NoError(t, err)
+		return authorizer
+	}
+	// 09:00 in Taipei is 01:00 UTC
+	at := time.Date(2024, 1, 1, 9, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	d, err := newAuthorizer("").Authorize(context.Background(), &auth.AuthzRequest{Time: at})
+	assert.NoError(t, err)
+	assert.False(t, d.Allow)
+	d, err = newAuthorizer("Asia/Taipei").Authorize(context.Background(), &auth.AuthzRequest{Time: at})
+	assert.NoError(t, err)
+	assert.True(t, d.Allow)
+
+	_, err = auth.NewPolicyAuthorizer(auth.PolicySet{Timezone: "Mars/Base"})
+	assert.Error(t, err)
+}
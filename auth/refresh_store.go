@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is used again,
+	// the whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshTokenRecord is the state of an issued refresh token.
+// The tokens rotated from the same login share a Family.
+type RefreshTokenRecord struct {
+	ID        string    `json:"id"`
+	Family    string    `json:"family"`
+	Subject   string    `json:"subject"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// RotatedTo is the id of the token replacing this one, a rotated token can't be used again.
+	RotatedTo string `json:"rotatedTo,omitempty"`
+	Revoked   bool   `json:"revoked,omitempty"`
+}
+
+func (r *RefreshTokenRecord) isExpired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// RefreshTokenStore keeps the refresh tokens issued by JwtConf, the implementations must be safe for concurrent use.
+type RefreshTokenStore interface {
+	Save(rec *RefreshTokenRecord) error
+	// Get returns ErrRefreshTokenNotFound if id is unknown or expired.
+	Get(id string) (*RefreshTokenRecord, error)
+	// Rotate atomically marks id rotated to next and saves next.
+	// It returns ErrRefreshTokenReused and revokes the family if id was already rotated.
+	Rotate(id string, next *RefreshTokenRecord) error
+	RevokeFamily(family string) error
+	RevokeUser(subject string) error
+}
+
+// NewMemoryRefreshTokenStore keeps the records in memory, the expired records are dropped on Save.
+func NewMemoryRefreshTokenStore() RefreshTokenStore {
+	return newMemoryRefreshTokenStore()
+}
+
+func newMemoryRefreshTokenStore() *memoryRefreshTokenStore {
+	return &memoryRefreshTokenStore{records: make(map[string]*RefreshTokenRecord)}
+}
+
+type memoryRefreshTokenStore struct {
+	lock    sync.Mutex
+	records map[string]*RefreshTokenRecord
+	// onChange is called with the lock held after the records changed.
+	onChange func() error
+}
+
+func (s *memoryRefreshTokenStore) changed() error {
+	if s.onChange == nil {
+		return nil
+	}
+	return s.onChange()
+}
+
+func (s *memoryRefreshTokenStore) prune(now time.Time) {
+	for id, rec := range s.records {
+		if rec.isExpired(now) {
+			delete(s.records, id)
+		}
+	}
+}
+
+func (s *memoryRefreshTokenStore) Save(rec *RefreshTokenRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prune(time.Now())
+	r := *rec
+	s.records[rec.ID] = &r
+	return s.changed()
+}
+
+func (s *memoryRefreshTokenStore) Get(id string) (*RefreshTokenRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rec, ok := s.records[id]
+	if !ok || rec.isExpired(time.Now()) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	r := *rec
+	return &r, nil
+}
+
+func (s *memoryRefreshTokenStore) Rotate(id string, next *RefreshTokenRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rec, ok := s.records[id]
+	if !ok || rec.isExpired(time.Now()) {
+		return ErrRefreshTokenNotFound
+	}
+	if rec.Revoked {
+		return ErrRefreshTokenRevoked
+	}
+	if rec.RotatedTo != "" {
+		s.revoke(func(r *RefreshTokenRecord) bool { return r.Family == rec.Family })
+		if err := s.changed(); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	rec.RotatedTo = next.ID
+	r := *next
+	s.records[next.ID] = &r
+	return s.changed()
+}
+
+func (s *memoryRefreshTokenStore) revoke(match func(r *RefreshTokenRecord) bool) {
+	for _, rec := range s.records {
+		if match(rec) {
+			rec.Revoked = true
+		}
+	}
+}
+
+func (s *memoryRefreshTokenStore) RevokeFamily(family string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.revoke(func(r *RefreshTokenRecord) bool { return r.Family == family })
+	return s.changed()
+}
+
+func (s *memoryRefreshTokenStore) RevokeUser(subject string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.revoke(func(r *RefreshTokenRecord) bool { return r.Subject == subject })
+	return s.changed()
+}
+
+// NewFileRefreshTokenStore keeps the records in memory and writes them to a json file on every change.
+// The existing records of file are loaded.
+func NewFileRefreshTokenStore(file string) (RefreshTokenStore, error) {
+	s := newMemoryRefreshTokenStore()
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var records []*RefreshTokenRecord
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, errors.Wrap(err, "load refresh token store fail")
+		}
+		for _, rec := range records {
+			s.records[rec.ID] = rec
+		}
+	}
+	s.onChange = func() error {
+		return writeRefreshTokenFile(file, s.records)
+	}
+	return s, nil
+}
+
+// writeRefreshTokenFile replaces file by renaming a temp file, so a crash doesn't leave a partial file.
+func writeRefreshTokenFile(file string, records map[string]*RefreshTokenRecord) error {
+	list := make([]*RefreshTokenRecord, 0, len(records))
+	for _, rec := range records {
+		list = append(list, rec)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	j := newTestJwtConf(t)
+	j.RefreshStore = auth.NewMemoryRefreshTokenStore()
+
+	first, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	second, err := j.RotateRefreshToken(first.RefreshToken)
+	assert.NoError(t, err)
+	token, err := j.ParseToken(second.AccessToken)
+	assert.NoError(t, err)
+	assert.Nil(t, token.Claims.(jwt.MapClaims)["fam"])
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, err = j.RefreshAccessToken(second.RefreshToken)
+	assert.NoError(t, err)
+
+	// reuse of the rotated token revokes the family
+	_, err = j.RotateRefreshToken(first.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+	_, err = j.RotateRefreshToken(second.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenRevoked)
+	_, err = j.RefreshAccessToken(second.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenRevoked)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	j := newTestJwtConf(t)
+	store := auth.NewMemoryRefreshTokenStore()
+	j.RefreshStore = store
+
+	login1, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	login2, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	other, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u2"}, 10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, j.RevokeRefreshToken(login1.RefreshToken))
+	_, err = j.RotateRefreshToken(login1.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenRevoked)
+	_, err = j.RefreshAccessToken(login2.RefreshToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.RevokeUser("u1"))
+	_, err = j.RefreshAccessToken(login2.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenRevoked)
+	_, err = j.RotateRefreshToken(other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestFileRefreshTokenStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "refresh.json")
+	store, err := auth.NewFileRefreshTokenStore(file)
+	assert.NoError(t, err)
+	j := newTestJwtConf(t)
+	j.RefreshStore = store
+
+	first, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	_, err = j.RotateRefreshToken(first.RefreshToken)
+	assert.NoError(t, err)
+
+	// the rotation survives a reload
+	j.RefreshStore, err = auth.NewFileRefreshTokenStore(file)
+	assert.NoError(t, err)
+	_, err = j.RotateRefreshToken(first.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenReused)
+}
+
+func TestRefreshTokenInvalidInput(t *testing.T) {
+	j := newTestJwtConf(t)
+	j.RefreshStore = auth.NewMemoryRefreshTokenStore()
+	token, err := j.GetTokenWithRefresh("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	tampered := []byte(token.RefreshToken)
+	tampered[len(tampered)/2] ^= 1
+
+	for _, input := range []string{"", "abc", base64.URLEncoding.EncodeToString([]byte("short")), "%%%", string(tampered)} {
+		_, err := j.RefreshAccessToken(input)
+		assert.ErrorIs(t, err, errors.Error_Auth_Invalid_Token, input)
+		_, err = j.RotateRefreshToken(input)
+		assert.ErrorIs(t, err, errors.Error_Auth_Invalid_Token, input)
+		assert.ErrorIs(t, j.RevokeRefreshToken(input), errors.Error_Auth_Invalid_Token, input)
+	}
+}
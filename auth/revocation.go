@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// RevocationStore keeps the revoked access tokens by jti, implement it with a shared
+// backend (e.g. redis) when the service runs more than one instance.
+type RevocationStore interface {
+	// Revoke rejects the token until exp, after that the token is expired anyway.
+	// RevokeToken pads exp with the leeway of the verifier.
+	Revoke(jti string, exp time.Time) error
+	IsRevoked(jti string) (bool, error)
+}
+
+// TokenReqUser is a ReqUser authenticated by a token with a jti.
+type TokenReqUser interface {
+	ReqUser
+	GetTokenID() string
+}
+
+const revocationPruneInterval = time.Minute
+
+// NewMemoryRevocationStore keeps the revoked jti in memory, the entries are evicted after exp.
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+type memoryRevocationStore struct {
+	lock      sync.Mutex
+	revoked   map[string]time.Time
+	lastPrune time.Time
+}
+
+func (s *memoryRevocationStore) Revoke(jti string, exp time.Time) error {
+	if jti == "" {
+		return errors.New("missing jti")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPrune) > revocationPruneInterval {
+		for id, e := range s.revoked {
+			if !now.Before(e) {
+				delete(s.revoked, id)
+			}
+		}
+		s.lastPrune = now
+	}
+	s.revoked[jti] = exp
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	exp, ok := s.revoked[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// RevokeToken revokes a parsed token by its jti and exp claims,
+// a token without exp is revoked for the max lifetime of GetToken.
+// leeway is the Leeway of the verifier, the token is accepted until exp + leeway so it's revoked until then.
+func RevokeToken(store RevocationStore, token *jwt.Token, leeway time.Duration) error {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return errors.New("invalid claims")
+	}
+	jti := getStrClaim(claims, ClaimsKeyJwtID)
+	if jti == "" {
+		return errors.New("token has no jti")
+	}
+	exp := time.Now().Add(180 * time.Minute)
+	if v, ok := claims["exp"].(float64); ok {
+		exp = time.Unix(int64(v), 0)
+	}
+	return store.Revoke(jti, exp.Add(leeway))
+}
+
+// BearAuthWithRevocationStore rejects the tokens revoked in store as invalid tokens,
+// the check fails closed on a store error. Tokens without jti are not checked.
+func BearAuthWithRevocationStore(store RevocationStore) BearAuthOption {
+	return func(m *bearAuthMiddle) {
+		m.revocations = store
+	}
+}
+
+func (m *bearAuthMiddle) isRevoked(user ReqUser) bool {
+	u, ok := user.(TokenReqUser)
+	if !ok || u.GetTokenID() == "" {
+		return false
+	}
+	revoked, err := m.revocations.IsRevoked(u.GetTokenID())
+	return err != nil || revoked
+}
@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinJwtAuthMidRevocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+	store := auth.NewMemoryRevocationStore()
+
+	m := auth.NewGinJwtAuthMid(j, false, auth.BearAuthWithRevocationStore(store))
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/users", http.MethodGet, true, nil)
+	r := gin.New()
+	r.GET("/users", m.Handler(), func(c *gin.Context) {})
+
+	tokenStr, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	request := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(auth.BearerAuthTokenKey, "Bearer "+*tokenStr)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, request())
+
+	token, err := j.ParseToken(*tokenStr)
+	assert.NoError(t, err)
+	assert.NoError(t, auth.RevokeToken(store, token, j.Claims.Leeway))
+	assert.Equal(t, http.StatusUnauthorized, request())
+}
+
+func TestRevokeTokenLeeway(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+	j.Claims.Leeway = time.Minute
+	store := auth.NewMemoryRevocationStore()
+	m := auth.NewGinJwtAuthMid(j, false, auth.BearAuthWithRevocationStore(store))
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/users", http.MethodGet, true, nil)
+	r := gin.New()
+	r.GET("/users", m.Handler(), func(c *gin.Context) {})
+
+	// just past exp, the token is still accepted within the leeway
+	tokenStr, err := auth.IssueToken(j, testUserClaims{RegisteredClaims: auth.RegisteredClaims{
+		Subject:   "u1",
+		IssuedAt:  time.Now().Add(-time.Hour).Unix(),
+		ExpiresAt: time.Now().Add(-10 * time.Second).Unix(),
+	}}, 0)
+	assert.NoError(t, err)
+	request := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(auth.BearerAuthTokenKey, "Bearer "+tokenStr)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, request())
+
+	token, err := j.ParseToken(tokenStr)
+	assert.NoError(t, err)
+	assert.NoError(t, auth.RevokeToken(store, token, j.Claims.Leeway))
+	assert.Equal(t, http.StatusUnauthorized, request())
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	store := auth.NewMemoryRevocationStore()
+	assert.Error(t, store.Revoke("", time.Now().Add(time.Minute)))
+
+	assert.NoError(t, store.Revoke("a", time.Now().Add(time.Minute)))
+	assert.NoError(t, store.Revoke("b", time.Now().Add(-time.Second)))
+	revoked, err := store.IsRevoked("a")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	// expired tokens don't need the revocation
+	revoked, _ = store.IsRevoked("b")
+	assert.False(t, revoked)
+	revoked, _ = store.IsRevoked("c")
+	assert.False(t, revoked)
+}
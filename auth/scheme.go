@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuthSchemeBearer        = "bearer"
+	AuthSchemeJwt           = "jwt"
+	AuthSchemeApiKey        = "api_key"
+	AuthSchemeHmac          = "hmac"
+	AuthSchemeCert          = "mtls"
+	AuthSchemeSession       = "session"
+	AuthSchemeIntrospection = "introspection"
+)
+
+// AuthScheme authenticates a request by one kind of credential, it's created by the New*AuthScheme functions.
+type AuthScheme struct {
+	name string
+	// challenge is the scheme of the WWW-Authenticate header, empty writes no challenge.
+	challenge string
+	// hostBound schemes issue users with the token host, it's checked when isMatchHost.
+	hostBound bool
+	// cookie is the credential cookie of the session scheme.
+	cookie   string
+	getToken tokenExtractor
+	loadUser reqUserLoader
+}
+
+func (s *AuthScheme) Name() string {
+	return s.name
+}
+
+// Cookie returns the cookie carrying the credential, empty if the credential isn't a cookie.
+func (s *AuthScheme) Cookie() string {
+	return s.cookie
+}
+
+// NewBearerAuthScheme accepts a bearer token when a previous middleware has bound the ReqUser to gin.
+func NewBearerAuthScheme() *AuthScheme {
+	return &AuthScheme{
+		name:      AuthSchemeBearer,
+		challenge: "Bearer",
+		hostBound: true,
+		getToken:  getBearerToken,
+		loadUser:  getReqUserFromGinCtx,
+	}
+}
+
+// NewSessionAuthScheme reads the session id from the cookie, load resolves the ReqUser of the session,
+// it returns errors.Error_Auth_Invalid_Token for an unknown or expired session.
+func NewSessionAuthScheme(cookieName string, load func(c *gin.Context, sessionID string) (ReqUser, error)) *AuthScheme {
+	return &AuthScheme{
+		name:   AuthSchemeSession,
+		cookie: cookieName,
+		getToken: func(c *gin.Context) (string, bool) {
+			sid, _ := c.Cookie(cookieName)
+			return sid, true
+		},
+		loadUser: func(c *gin.Context, sid string) (ReqUser, error) {
+			user, err := load(c, sid)
+			if err != nil {
+				return nil, err
+			}
+			if user == nil {
+				return nil, errors.Error_Auth_Invalid_Token
+			}
+			return user, nil
+		},
+	}
+}
+
+// NewGinMultiAuthMid returns an auth middleware trying schemes in order, the first scheme
+// authenticating the request wins and its name is recorded on the ReqUser (see GetAuthScheme).
+// A scheme without its credential in the request is skipped, the error of the first failed scheme
+// is returned when none succeeds. The routes can restrict the schemes by SetAuthSchemes.
+func NewGinMultiAuthMid(isMatchHost bool, schemes []*AuthScheme, opts ...BearAuthOption) GinSchemeAuthMidInter {
+	return newBearAuthMiddle(isMatchHost, schemes, opts...)
+}
+
+// GinSchemeAuthMidInter is an auth middleware supporting the per route schemes of GinApiHandler.AuthSchemes.
+type GinSchemeAuthMidInter interface {
+	GinAuthMidInter
+	// SetAuthSchemes accepts only the named schemes on the route, nil accepts all.
+	SetAuthSchemes(path, method string, schemes []string)
+	// AuthSchemes returns the schemes of the middleware in order.
+	AuthSchemes() []*AuthScheme
+}
+
+func (am *bearAuthMiddle) AuthSchemes() []*AuthScheme {
+	return am.schemes
+}
+
+func (am *bearAuthMiddle) SetAuthSchemes(path, method string, schemes []string) {
+	am.schemeMap[getPathKey(path, method)] = schemes
+}
+
+func (am *bearAuthMiddle) isSchemeAllowed(path, method, scheme string) bool {
+	allowed, ok := am.schemeMap[getPathKey(path, method)]
+	if !ok {
+		allowed = am.schemeMap[getPathKey(path, MethodAnyPerm)]
+	}
+	return len(allowed) == 0 || isStrInList(scheme, allowed...)
+}
+
+// authenticate runs the allowed schemes, it returns the RFC 6750 error code and the mapped error on failure.
+func (m *bearAuthMiddle) authenticate(c *gin.Context, path, method string) (ReqUser, *AuthScheme, string, error) {
+	var firstErr error
+	malformed := false
+	for _, s := range m.schemes {
+		if !m.isSchemeAllowed(path, method, s.name) {
+			continue
+		}
+		token, ok := s.getToken(c)
+		if !ok {
+			malformed = true
+			continue
+		}
+		if token == "" {
+			continue
+		}
+		user, err := s.loadUser(c, token)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		user = withAuthScheme(user, s.name)
+		bindReqUser(c, user)
+		return user, s, "", nil
+	}
+	if firstErr != nil {
+		bearerErr, err := m.loaderError(firstErr)
+		return nil, nil, bearerErr, err
+	}
+	if malformed {
+		return nil, nil, bearerErrInvalidRequest, m.errs.InvalidToken
+	}
+	return nil, nil, "", m.errs.MissToken
+}
+
+// SchemeReqUser is a ReqUser authenticated by a named AuthScheme.
+type SchemeReqUser interface {
+	ReqUser
+	GetAuthScheme() string
+}
+
+// GetAuthScheme returns the scheme authenticating user, empty if unknown.
+func GetAuthScheme(user ReqUser) string {
+	if u, ok := user.(SchemeReqUser); ok {
+		return u.GetAuthScheme()
+	}
+	return ""
+}
+
+type schemeReqUser struct {
+	ReqUser
+	scheme string
+}
+
+func (u *schemeReqUser) GetAuthScheme() string {
+	return u.scheme
+}
+
+func withAuthScheme(user ReqUser, scheme string) ReqUser {
+	// the loaders may return a cached user, so the scheme is set on a copy.
+	switch u := user.(type) {
+	case *reqUserImpl:
+		cp := *u
+		cp.scheme = scheme
+		return &cp
+	case *schemeReqUser:
+		return &schemeReqUser{ReqUser: u.ReqUser, scheme: scheme}
+	}
+	return &schemeReqUser{ReqUser: user, scheme: scheme}
+}
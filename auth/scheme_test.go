@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinMultiAuthMid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := newTestJwtConf(t)
+	keys := auth.NewMemoryApiKeyStore()
+	apiKey, err := auth.CreateApiKey(keys, &auth.ApiKey{UserID: "cron", Perms: []string{"report:read"}})
+	assert.NoError(t, err)
+	// the session users are cached, the middleware must not change them
+	cached := auth.NewReqUser("", "web-user", "web", "web", []string{"report:read"}, "")
+	session := auth.NewSessionAuthScheme("sid", func(c *gin.Context, sid string) (auth.ReqUser, error) {
+		if sid != "s1" {
+			return nil, errors.Error_Auth_Invalid_Token
+		}
+		return cached, nil
+	})
+
+	m := auth.NewGinMultiAuthMid(false, []*auth.AuthScheme{
+		auth.NewJwtAuthScheme(j), auth.NewApiKeyAuthScheme(keys), session,
+	})
+	m.SetApiErrorHandler(testErrorHandler)
+	m.AddAuthPath("/reports", http.MethodGet, true, []auth.ApiPerm{"report:read"})
+	m.AddAuthPath("/machine", http.MethodGet, true, nil)
+	m.SetAuthSchemes("/machine", http.MethodGet, []string{auth.AuthSchemeApiKey})
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		u := auth.GetReqUserFromGin(c)
+		assert.Equal(t, u, auth.GetReqUserFromCtx(c.Request.Context()))
+		c.String(http.StatusOK, u.GetId()+":"+auth.GetAuthScheme(u))
+	}
+	r.GET("/reports", m.Handler(), handler)
+	r.GET("/machine", m.Handler(), handler)
+
+	jwtToken, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1", "roles": []string{"report:read"}}, 10)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		url        string
+		header     http.Header
+		statusCode int
+		body       string
+	}{
+		{name: "miss credential", url: "/reports", statusCode: http.StatusUnauthorized},
+		{name: "jwt", url: "/reports", header: http.Header{"Authorization": {"Bearer " + *jwtToken}},
+			statusCode: http.StatusOK, body: "u1:jwt"},
+		{name: "api key", url: "/reports", header: http.Header{auth.ApiKeyHeaderKey: {apiKey}},
+			statusCode: http.StatusOK, body: "cron:api_key"},
+		{name: "session", url: "/reports", header: http.Header{"Cookie": {"sid=s1"}},
+			statusCode: http.StatusOK, body: "web-user:session"},
+		{name: "invalid jwt falls back to session", url: "/reports",
+			header:     http.Header{"Authorization": {"Bearer abc"}, "Cookie": {"sid=s1"}},
+			statusCode: http.StatusOK, body: "web-user:session"},
+		{name: "invalid session", url: "/reports", header: http.Header{"Cookie": {"sid=s2"}}, statusCode: http.StatusUnauthorized},
+		{name: "scheme not allowed", url: "/machine", header: http.Header{"Authorization": {"Bearer " + *jwtToken}},
+			statusCode: http.StatusUnauthorized},
+		{name: "allowed scheme", url: "/machine", header: http.Header{auth.ApiKeyHeaderKey: {apiKey}},
+			statusCode: http.StatusOK, body: "cron:api_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			for k, v := range tt.header {
+				req.Header.Add(k, v[0])
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+	assert.Empty(t, auth.GetAuthScheme(cached))
+}
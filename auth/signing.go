@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningMethodEdDSA is the Ed25519 signing method, jwt-go v3 doesn't provide it.
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(AlgEdDSA, func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEd25519 struct{}
+
+func (m *signingMethodEd25519) Alg() string {
+	return AlgEdDSA
+}
+
+func (m *signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	pk, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pk, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
+func (m *signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	pk, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(pk, []byte(signingString))), nil
+}
+
+// getSigningMethod returns the signing method of an allowed asymmetric algorithm.
+func getSigningMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "", AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgES384:
+		return jwt.SigningMethodES384, nil
+	case AlgEdDSA:
+		return SigningMethodEdDSA, nil
+	}
+	return nil, errors.Errorf("unsupported algorithm [%s]", alg)
+}
+
+// checkAlg rejects a token whose alg is not the expected one, e.g. alg confusion of HS256 with a public key.
+func checkAlg(token *jwt.Token, expected string) error {
+	if expected == "" {
+		expected = AlgRS256
+	}
+	if token.Method == nil || token.Method.Alg() != expected {
+		return errors.Errorf("unexpected signing method [%v]", token.Header["alg"])
+	}
+	return nil
+}
+
+// matchKeyAlg reports whether the key type can verify alg.
+func matchKeyAlg(alg string, key crypto.PublicKey) bool {
+	switch pk := key.(type) {
+	case *rsa.PublicKey:
+		return alg == AlgRS256
+	case *ecdsa.PublicKey:
+		return (alg == AlgES256 && pk.Curve == elliptic.P256()) ||
+			(alg == AlgES384 && pk.Curve == elliptic.P384())
+	case ed25519.PublicKey:
+		return alg == AlgEdDSA
+	}
+	return false
+}
+
+// parsePrivateKeyFromPEM parses a PKCS1 RSA, SEC1 EC or PKCS8 (RSA, EC, Ed25519) private key.
+func parsePrivateKeyFromPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid private key pem")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key fail")
+	}
+	return key, nil
+}
+
+// parsePublicKeyFromPEM parses a PKIX (RSA, EC, Ed25519) or PKCS1 RSA public key.
+func parsePublicKeyFromPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid public key pem")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse public key fail")
+	}
+	return key, nil
+}
+
+// GenerateKeys generates a key pair of alg, bitsize is only used by RS256.
+func GenerateKeys(alg string, bitsize int, privateFile, publicFile string) error {
+	switch alg {
+	case "", AlgRS256:
+		return GenerateRsaKeys(bitsize, privateFile, publicFile)
+	case AlgES256:
+		return GenerateEcdsaKeys(elliptic.P256(), privateFile, publicFile)
+	case AlgES384:
+		return GenerateEcdsaKeys(elliptic.P384(), privateFile, publicFile)
+	case AlgEdDSA:
+		return GenerateEd25519Keys(privateFile, publicFile)
+	}
+	return errors.Errorf("unsupported algorithm [%s]", alg)
+}
+
+func GenerateEcdsaKeys(curve elliptic.Curve, privateFile, publicFile string) error {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	return writeKeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER}),
+		&privateKey.PublicKey, privateFile, publicFile)
+}
+
+func GenerateEd25519Keys(privateFile, publicFile string) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	return writeKeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		publicKey, privateFile, publicFile)
+}
+
+func writeKeyPair(privatePEM []byte, publicKey crypto.PublicKey, privateFile, publicFile string) error {
+	pubDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if err := writeKeyToFile(privatePEM, privateFile); err != nil {
+		return err
+	}
+	return writeKeyToFile(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), publicFile)
+}
+
+// NewJWK converts a RSA, ECDSA or Ed25519 public key to a JWK.
+func NewJWK(kid string, key crypto.PublicKey) (JWK, error) {
+	switch pk := key.(type) {
+	case *rsa.PublicKey:
+		return NewRsaJWK(kid, pk), nil
+	case *ecdsa.PublicKey:
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		jwk := JWK{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			X:   base64.RawURLEncoding.EncodeToString(pk.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(pk.Y.FillBytes(make([]byte, size))),
+		}
+		switch pk.Curve {
+		case elliptic.P256():
+			jwk.Crv, jwk.Alg = "P-256", AlgES256
+		case elliptic.P384():
+			jwk.Crv, jwk.Alg = "P-384", AlgES384
+		default:
+			return JWK{}, errors.New("unsupported curve")
+		}
+		return jwk, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: AlgEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pk),
+		}, nil
+	}
+	return JWK{}, errors.Errorf("unsupported key type %T", key)
+}
+
+func decodeJwkEcPublicKey(k JWK) (crypto.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, errors.Errorf("unsupported jwk crv [%s]", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	pk := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(pk.X, pk.Y) {
+		return nil, errors.New("invalid ec jwk")
+	}
+	return pk, nil
+}
+
+func decodeJwkOkpPublicKey(k JWK) (crypto.PublicKey, error) {
+	if k.Crv != "Ed25519" {
+		return nil, errors.Errorf("unsupported jwk crv [%s]", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid okp jwk")
+	}
+	return ed25519.PublicKey(x), nil
+}
@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAlgJwtConf(t *testing.T, alg string) *auth.JwtConf {
+	dir := t.TempDir()
+	j := &auth.JwtConf{
+		Algorithm:      alg,
+		PrivateKeyFile: filepath.Join(dir, "private.pem"),
+		PublicKeyFile:  filepath.Join(dir, "public.pem"),
+	}
+	j.Header.Kid = "kid-" + alg
+	if err := j.GenerateKeys(2048); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestJwtConfAlgorithms(t *testing.T) {
+	for _, alg := range []string{auth.AlgRS256, auth.AlgES256, auth.AlgES384, auth.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			j := newTestAlgJwtConf(t, alg)
+			tokenStr, err := j.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+			assert.NoError(t, err)
+			token, err := j.ParseToken(*tokenStr)
+			assert.NoError(t, err)
+			assert.Equal(t, alg, token.Header["alg"])
+
+			accessToken, err := j.GetAccessToken("example.com", "order", "o1", "db", "read")
+			assert.NoError(t, err)
+			token, err = j.ParseToken(*accessToken)
+			assert.NoError(t, err)
+			assert.Equal(t, "access", token.Header["usa"])
+
+			jwks, err := j.GetJWKS()
+			assert.NoError(t, err)
+			assert.Equal(t, alg, jwks.Keys[0].Alg)
+			jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(jwks)
+			}))
+			defer jwksServer.Close()
+			_, err = (&auth.JwksConf{URL: jwksServer.URL}).NewJwt().ParseToken(*tokenStr)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJwtConfRejectAlgConfusion(t *testing.T) {
+	j := newTestAlgJwtConf(t, auth.AlgRS256)
+	publicPEM, err := os.ReadFile(j.PublicKeyFile)
+	assert.NoError(t, err)
+
+	// HS256 signed with the public key as secret
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "attacker"})
+	token.Header["kid"] = j.GetKid()
+	forged, err := token.SignedString(publicPEM)
+	assert.NoError(t, err)
+	_, err = j.ParseToken(forged)
+	assert.Error(t, err)
+
+	// a token of another algorithm with the same kid
+	es := newTestAlgJwtConf(t, auth.AlgES256)
+	es.Header.Kid = j.GetKid()
+	esToken, err := es.GetToken("example.com", map[string]interface{}{"sub": "u1"}, 10)
+	assert.NoError(t, err)
+	_, err = j.ParseToken(*esToken)
+	assert.Error(t, err)
+}
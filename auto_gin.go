@@ -7,12 +7,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/94peter/api-toolkit/auth"
+	apierrors "github.com/94peter/api-toolkit/errors"
 	"github.com/94peter/api-toolkit/mid"
 )
 
 func autoGinApiServer(cfg *Config) (*http.Server, error) {
 	if cfg.errorHandler == nil {
-		return nil, errors.New("missing error handler")
+		cfg.errorHandler = apierrors.NewProblemErrorHandler()
 	}
 
 	server := NewGinApiServer(cfg.GinMode, cfg.Service).
@@ -37,6 +39,12 @@ func autoGinApiServer(cfg *Config) (*http.Server, error) {
 	if len(cfg.proms) > 0 {
 		server = server.SetPromhttp(cfg.proms...)
 	}
+	if err := setOpenAPI(server, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.jwks != nil {
+		server = server.SetJWKS(cfg.jwks, auth.DefaultJwksMaxAge)
+	}
 	if cfg.Logger != nil {
 		authMode := "release"
 		if cfg.IsMockAuth {
@@ -45,9 +53,25 @@ func autoGinApiServer(cfg *Config) (*http.Server, error) {
 		cfg.Logger.Infof("run api at port: [%d], auth mode: [%s]",
 			cfg.ApiPort, authMode)
 	}
+	if cfg.TLS != nil {
+		return server.GetTLSServer(cfg.ApiPort, cfg.TLS)
+	}
 	return server.GetServer(cfg.ApiPort), nil
 }
 
+func setOpenAPI(server GinApiServer, cfg *Config) error {
+	if cfg.OpenAPIPath == "" && cfg.OpenAPIExportFile == "" {
+		return nil
+	}
+	server.SetOpenAPI(cfg.OpenAPIPath, cfg.openAPIInfo)
+	if cfg.OpenAPIExportFile != "" {
+		if err := server.ExportOpenAPI(cfg.OpenAPIExportFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func AutoGinApiRun(ctx context.Context, cfg *Config) error {
 	var apiWait sync.WaitGroup
 	server, err := autoGinApiServer(cfg)
@@ -59,7 +83,7 @@ func AutoGinApiRun(ctx context.Context, cfg *Config) error {
 	go func(srv *http.Server) {
 
 		for {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
 				cfg.Logger.Fatalf("listen: %s", err)
 				time.Sleep(fiveSecods)
 			} else if err == http.ErrServerClosed {
@@ -81,7 +105,7 @@ func AutoGinApiRun(ctx context.Context, cfg *Config) error {
 
 func autoGinApiServerWithBindUser[T mid.BindUser](cfg *ConfigWithBindUser[T]) (*http.Server, error) {
 	if cfg.errorHandler == nil {
-		return nil, errors.New("missing error handler")
+		cfg.errorHandler = apierrors.NewProblemErrorHandler()
 	}
 
 	server := NewGinApiServer(cfg.GinMode, cfg.Service).
@@ -122,6 +146,12 @@ func autoGinApiServerWithBindUser[T mid.BindUser](cfg *ConfigWithBindUser[T]) (*
 	if len(cfg.proms) > 0 {
 		server = server.SetPromhttp(cfg.proms...)
 	}
+	if err := setOpenAPI(server, cfg.Config); err != nil {
+		return nil, err
+	}
+	if cfg.jwks != nil {
+		server = server.SetJWKS(cfg.jwks, auth.DefaultJwksMaxAge)
+	}
 	if cfg.Logger != nil {
 		authMode := "release"
 		if cfg.IsMockAuth {
@@ -130,6 +160,9 @@ func autoGinApiServerWithBindUser[T mid.BindUser](cfg *ConfigWithBindUser[T]) (*
 		cfg.Logger.Infof("run api at port: [%d], auth mode: [%s]",
 			cfg.ApiPort, authMode)
 	}
+	if cfg.TLS != nil {
+		return server.GetTLSServer(cfg.ApiPort, cfg.TLS)
+	}
 	return server.GetServer(cfg.ApiPort), nil
 }
 
@@ -144,7 +177,7 @@ func AutoGinApiRunWithBindUser[T mid.BindUser](ctx context.Context, cfg *ConfigW
 	go func(srv *http.Server) {
 
 		for {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
 				cfg.Logger.Fatalf("listen: %s", err)
 				time.Sleep(fiveSecods)
 			} else if err == http.ErrServerClosed {
@@ -163,3 +196,11 @@ func AutoGinApiRunWithBindUser[T mid.BindUser](ctx context.Context, cfg *ConfigW
 	apiWait.Wait()
 	return nil
 }
+
+// listenAndServe serves https when srv has the TLSConfig of GetTLSServer.
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
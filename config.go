@@ -29,6 +29,16 @@ const (
 	envTrustedProxies = "TRUSTED_PROXIES"
 	envSessionHeader  = "SESSION_HEADER_NAME"
 	envSessionExpired = "SESSION_EXPIRED"
+
+	envOpenAPIPath       = "OPENAPI_PATH"
+	envOpenAPIExportFile = "OPENAPI_EXPORT_FILE"
+
+	envTLSCertFile     = "TLS_CERT_FILE"
+	envTLSKeyFile      = "TLS_KEY_FILE"
+	envTLSMinVersion   = "TLS_MIN_VERSION"
+	envTLSCipherSuites = "TLS_CIPHER_SUITES"
+	envTLSClientCAFile = "TLS_CLIENT_CA_FILE"
+	envTLSClientAuth   = "TLS_CLIENT_AUTH"
 )
 
 // config holds the configuration
@@ -42,7 +52,12 @@ type Config struct {
 	Debug             bool // autopaho and paho debug output requested
 	SessionHeaderName string
 	SessionExpired    time.Duration
+	OpenAPIPath       string     // serve the OpenAPI document at this path if not empty
+	OpenAPIExportFile string     // export the OpenAPI document to this file if not empty
+	TLS               *TLSConfig // serve https if not nil
 
+	openAPIInfo    OpenAPIInfo
+	jwks           auth.JwksProvider
 	proms          []prometheus.Collector
 	authMid        auth.GinAuthMidInter
 	preAuthMiddles []mid.GinMiddle
@@ -78,6 +93,15 @@ func (cfg *Config) SetSessionStore(store session.ManagerStore) {
 	cfg.store = store
 }
 
+func (cfg *Config) SetOpenAPIInfo(info OpenAPIInfo) {
+	cfg.openAPIInfo = info
+}
+
+// SetJWKS serves the public keys of provider at /.well-known/jwks.json.
+func (cfg *Config) SetJWKS(provider auth.JwksProvider) {
+	cfg.jwks = provider
+}
+
 func (cfg *Config) getMiddles() []mid.GinMiddle {
 	count := 0
 	var middles []mid.GinMiddle
@@ -170,9 +194,44 @@ func GetConfigFromEnv() (*Config, error) {
 		cfg.SessionExpired = -1
 	}
 
+	cfg.OpenAPIPath, _ = stringFromEnv(envOpenAPIPath)
+	cfg.OpenAPIExportFile, _ = stringFromEnv(envOpenAPIExportFile)
+
+	cfg.TLS, err = tlsConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+// tlsConfigFromEnv returns nil when TLS_CERT_FILE is blank.
+// TLS_CLIENT_AUTH is "require" (default) or "optional" when TLS_CLIENT_CA_FILE is set.
+func tlsConfigFromEnv() (*TLSConfig, error) {
+	certFile, err := stringFromEnv(envTLSCertFile)
+	if err != nil {
+		return nil, nil
+	}
+	keyFile, err := stringFromEnv(envTLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &TLSConfig{CertFile: certFile, KeyFile: keyFile}
+	conf.MinVersion, _ = stringFromEnv(envTLSMinVersion)
+	if ciphers, err := stringFromEnv(envTLSCipherSuites); err == nil {
+		conf.CipherSuites = strings.Split(ciphers, ",")
+	}
+	conf.ClientCAFile, _ = stringFromEnv(envTLSClientCAFile)
+	switch clientAuth, _ := stringFromEnv(envTLSClientAuth); clientAuth {
+	case "", "require":
+	case "optional":
+		conf.ClientAuthOptional = true
+	default:
+		return nil, fmt.Errorf("environmental variable %s must be require or optional", envTLSClientAuth)
+	}
+	return conf, nil
+}
+
 // stringFromEnv - Retrieves a string from the environment and ensures it is not blank (ort non-existent)
 func stringFromEnv(key string) (string, error) {
 	s := os.Getenv(key)
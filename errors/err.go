@@ -17,28 +17,106 @@ type GinServerErrorHandler func(c *gin.Context, service string, err error)
 
 type ApiError interface {
 	GetStatus() int
+	// GetKey returns the machine-readable error code, it's empty for unregistered errors.
+	GetKey() string
+	GetDetails() []ErrorDetail
 	error
 }
 
+// ErrorDetail describes a single problem of the request, e.g. a field validation failure.
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
 type myApiError struct {
 	statusCode int
-	error
+	key        string
+	msg        string
+	details    []ErrorDetail
+	cause      error
 }
 
-func (e myApiError) GetStatus() int {
+func (e *myApiError) GetStatus() int {
 	return e.statusCode
 }
 
-func (e myApiError) String() string {
-	return fmt.Sprintf("%v: %v", e.statusCode, e.error)
+func (e *myApiError) GetKey() string {
+	return e.key
+}
+
+func (e *myApiError) GetDetails() []ErrorDetail {
+	return e.details
+}
+
+func (e *myApiError) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+	if e.msg == "" {
+		return e.cause.Error()
+	}
+	return e.msg + ": " + e.cause.Error()
+}
+
+func (e *myApiError) Unwrap() error {
+	return e.cause
+}
+
+// Is reports errors with the same key as equal, so errors.Is works for copies made by Wrap and WithDetails.
+func (e *myApiError) Is(target error) bool {
+	t, ok := target.(*myApiError)
+	return ok && e.key != "" && e.key == t.key
+}
+
+func (e *myApiError) String() string {
+	return fmt.Sprintf("%v: %v", e.statusCode, e.Error())
+}
+
+func (e *myApiError) clone() *myApiError {
+	c := *e
+	c.details = append([]ErrorDetail{}, e.details...)
+	return &c
 }
 
 func New(status int, msg string) ApiError {
-	return myApiError{statusCode: status, error: errors.New(msg)}
+	return &myApiError{statusCode: status, msg: msg}
 }
 
 func PkgError(status int, err error) ApiError {
-	return myApiError{statusCode: status, error: err}
+	e := &myApiError{statusCode: status, cause: err}
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		e.key = apiErr.GetKey()
+	}
+	return e
+}
+
+// Wrap returns a copy of err with cause attached, errors.Is matches both err and cause.
+func Wrap(err ApiError, cause error) ApiError {
+	e := toMyApiError(err)
+	e.cause = cause
+	return e
+}
+
+// WithDetails returns a copy of err with details appended.
+func WithDetails(err ApiError, details ...ErrorDetail) ApiError {
+	e := toMyApiError(err)
+	e.details = append(e.details, details...)
+	return e
+}
+
+func toMyApiError(err ApiError) *myApiError {
+	if e, ok := err.(*myApiError); ok {
+		return e.clone()
+	}
+	return &myApiError{
+		statusCode: err.GetStatus(),
+		key:        err.GetKey(),
+		details:    append([]ErrorDetail{}, err.GetDetails()...),
+		cause:      err,
+	}
 }
 
 type CommonApiErrorHandler struct {
@@ -50,9 +128,10 @@ func (api *CommonApiErrorHandler) SetApiErrorHandler(handler GinApiErrorHandler)
 }
 
 var (
-	Error_Auth_Path_NotFound  = New(http.StatusNotFound, "auth path not found")
-	Error_Auth_Miss_Token     = New(http.StatusUnauthorized, "miss token")
-	Error_Auth_Invalid_Token  = New(http.StatusUnauthorized, "invalid token")
-	Error_Auth_Host_Not_Match = New(http.StatusUnauthorized, "host not match")
-	Error_Auth_No_Perm        = New(http.StatusUnauthorized, "no permission")
+	Error_Auth_Path_NotFound  = Register("AUTH_PATH_NOT_FOUND", http.StatusNotFound, "auth path not found")
+	Error_Auth_Miss_Token     = Register("AUTH_MISS_TOKEN", http.StatusUnauthorized, "miss token")
+	Error_Auth_Invalid_Token  = Register("AUTH_INVALID_TOKEN", http.StatusUnauthorized, "invalid token")
+	Error_Auth_Host_Not_Match = Register("AUTH_HOST_NOT_MATCH", http.StatusForbidden, "host not match")
+	Error_Auth_No_Perm        = Register("AUTH_NO_PERM", http.StatusForbidden, "no permission")
+	Error_Auth_Invalid_State  = Register("AUTH_INVALID_STATE", http.StatusBadRequest, "invalid login state")
 )
@@ -0,0 +1,54 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestUserNotFound = Register("TEST_USER_NOT_FOUND", http.StatusNotFound, "user not found")
+
+func TestApiErrorWrap(t *testing.T) {
+	cause := errors.New("record not found")
+
+	err := Wrap(errTestUserNotFound, cause)
+	assert.Equal(t, "user not found: record not found", err.Error())
+	assert.True(t, errors.Is(err, errTestUserNotFound))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, Error_Auth_No_Perm))
+	assert.Equal(t, "TEST_USER_NOT_FOUND", err.GetKey())
+
+	pkgErr := PkgError(http.StatusBadRequest, err)
+	assert.Equal(t, "TEST_USER_NOT_FOUND", pkgErr.GetKey())
+	assert.True(t, errors.Is(pkgErr, cause))
+	var apiErr ApiError
+	assert.True(t, errors.As(pkgErr, &apiErr))
+
+	detailErr := WithDetails(errTestUserNotFound, ErrorDetail{Field: "id", Key: "required"})
+	assert.Len(t, detailErr.GetDetails(), 1)
+	assert.Empty(t, errTestUserNotFound.GetDetails())
+	assert.True(t, errors.Is(detailErr, errTestUserNotFound))
+
+	assert.Empty(t, New(http.StatusBadRequest, "bad").GetKey())
+	assert.False(t, errors.Is(New(http.StatusBadRequest, "bad"), New(http.StatusBadRequest, "bad")))
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Panics(t, func() {
+		Register("AUTH_NO_PERM", http.StatusForbidden, "duplicate")
+	})
+	err, ok := Lookup("AUTH_MISS_TOKEN")
+	assert.True(t, ok)
+	assert.Equal(t, Error_Auth_Miss_Token, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, ExportCodes(&buf))
+	var codes []ErrorCode
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &codes))
+	assert.Equal(t, GetCodes(), codes)
+	assert.Contains(t, codes, ErrorCode{Key: "AUTH_NO_PERM", Status: http.StatusForbidden, Message: "no permission"})
+}
@@ -0,0 +1,159 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	LangEn   = "en"
+	LangZhTW = "zh-TW"
+)
+
+// DefaultCatalog is used by the problem error handler unless ProblemWithCatalog is set.
+var DefaultCatalog = NewCatalog(LangEn)
+
+func init() {
+	DefaultCatalog.Add(LangEn, map[string]string{
+		"AUTH_PATH_NOT_FOUND": "auth path not found",
+		"AUTH_MISS_TOKEN":     "miss token",
+		"AUTH_INVALID_TOKEN":  "invalid token",
+		"AUTH_HOST_NOT_MATCH": "host not match",
+		"AUTH_NO_PERM":        "no permission",
+		"AUTH_INVALID_STATE":  "invalid login state",
+	})
+	DefaultCatalog.Add(LangZhTW, map[string]string{
+		"AUTH_PATH_NOT_FOUND": "找不到授權路徑",
+		"AUTH_MISS_TOKEN":     "缺少存取權杖",
+		"AUTH_INVALID_TOKEN":  "無效的存取權杖",
+		"AUTH_HOST_NOT_MATCH": "主機不符",
+		"AUTH_NO_PERM":        "沒有權限",
+		"AUTH_INVALID_STATE":  "無效的登入狀態",
+	})
+}
+
+// Catalog holds the localized messages keyed by language and error key.
+// A lookup of zh-TW falls back to zh, then to the default language.
+type Catalog struct {
+	lock        sync.RWMutex
+	defaultLang string
+	messages    map[string]map[string]string
+}
+
+func NewCatalog(defaultLang string) *Catalog {
+	return &Catalog{
+		defaultLang: normalizeLang(defaultLang),
+		messages:    make(map[string]map[string]string),
+	}
+}
+
+// Add merges messages of lang into the catalog.
+func (c *Catalog) Add(lang string, messages map[string]string) {
+	lang = normalizeLang(lang)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.messages[lang]; !ok {
+		c.messages[lang] = make(map[string]string, len(messages))
+	}
+	for key, msg := range messages {
+		c.messages[lang][key] = msg
+	}
+}
+
+// LoadFile adds the messages of a json file ({"ERROR_KEY": "message"}) to lang.
+func (c *Catalog) LoadFile(lang, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	messages := make(map[string]string)
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+	c.Add(lang, messages)
+	return nil
+}
+
+// Localize returns the message of key in the first matched language and the language used.
+func (c *Catalog) Localize(key string, langs ...string) (msg string, lang string, ok bool) {
+	if key == "" {
+		return "", "", false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	candidates := make([]string, 0, len(langs)+1)
+	candidates = append(append(candidates, langs...), c.defaultLang)
+	for _, l := range candidates {
+		l = normalizeLang(l)
+		if msg, ok := c.messages[l][key]; ok {
+			return msg, l, true
+		}
+		if i := strings.Index(l, "-"); i > 0 {
+			if msg, ok := c.messages[l[:i]][key]; ok {
+				return msg, l[:i], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// LocalizeRequest localizes err by the Accept-Language header of req.
+func (c *Catalog) LocalizeRequest(req *http.Request, err ApiError) (msg string, lang string, ok bool) {
+	return c.Localize(err.GetKey(), ParseAcceptLanguage(req.Header.Get("Accept-Language"))...)
+}
+
+// ParseAcceptLanguage returns the languages of an Accept-Language header ordered by quality.
+func ParseAcceptLanguage(header string) []string {
+	type langQ struct {
+		lang string
+		q    float64
+	}
+	var items []langQ
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lang, q := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			lang = strings.TrimSpace(part[:i])
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if lang == "*" || q <= 0 {
+			continue
+		}
+		items = append(items, langQ{lang: lang, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	langs := make([]string, len(items))
+	for i, item := range items {
+		langs[i] = item.lang
+	}
+	return langs
+}
+
+// normalizeLang formats a language tag as language-REGION, e.g. zh_tw to zh-TW.
+func normalizeLang(lang string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
@@ -0,0 +1,60 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"zh-TW", "zh", "en"}, ParseAcceptLanguage("en;q=0.5, zh-TW, zh;q=0.8, *;q=0.1"))
+	assert.Empty(t, ParseAcceptLanguage(""))
+}
+
+func TestCatalogLocalize(t *testing.T) {
+	catalog := NewCatalog(LangEn)
+	catalog.Add(LangEn, map[string]string{"A": "a-en", "B": "b-en"})
+	catalog.Add("zh", map[string]string{"A": "a-zh"})
+	file := filepath.Join(t.TempDir(), "zh-TW.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"B":"b-zh-tw"}`), 0600))
+	assert.NoError(t, catalog.LoadFile("zh_tw", file))
+
+	tests := []struct {
+		key, msg, lang string
+		langs          []string
+		ok             bool
+	}{
+		{key: "B", langs: []string{"zh-tw"}, msg: "b-zh-tw", lang: "zh-TW", ok: true},
+		{key: "A", langs: []string{"zh-TW"}, msg: "a-zh", lang: "zh", ok: true},
+		{key: "A", langs: []string{"ja"}, msg: "a-en", lang: "en", ok: true},
+		{key: "C", langs: []string{"zh-TW"}},
+		{key: "", langs: []string{"zh-TW"}},
+	}
+	for _, tt := range tests {
+		msg, lang, ok := catalog.Localize(tt.key, tt.langs...)
+		assert.Equal(t, tt.ok, ok)
+		assert.Equal(t, tt.msg, msg)
+		assert.Equal(t, tt.lang, lang)
+	}
+}
+
+func TestProblemErrorHandlerLocalize(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept-Language", "zh-TW,zh;q=0.9,en;q=0.8")
+
+	NewProblemErrorHandler()(c, "svc", Error_Auth_No_Perm)
+
+	var got Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "沒有權限", got.Detail)
+	assert.Equal(t, "AUTH_NO_PERM", got.Code)
+	assert.Equal(t, LangZhTW, w.Header().Get("Content-Language"))
+}
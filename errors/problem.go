@@ -0,0 +1,157 @@
+package errors
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	HeaderRequestID    = "X-Request-Id"
+	HeaderTraceID      = "X-Trace-Id"
+
+	problemTypeBlank = "about:blank"
+)
+
+// Problem is the RFC 7807 problem details object.
+type Problem struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title"`
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"`
+	Service  string        `json:"service,omitempty"`
+	TraceID  string        `json:"traceId,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Details  []ErrorDetail `json:"details,omitempty"`
+}
+
+type ProblemOption func(*problemHandler)
+
+// ProblemWithTypeBaseURI sets the base uri of type, the status code is appended, e.g. https://errors.example.com/404.
+// The default type is about:blank.
+func ProblemWithTypeBaseURI(uri string) ProblemOption {
+	return func(h *problemHandler) {
+		h.typeBaseURI = uri
+	}
+}
+
+// ProblemWithHideInternalError hides the error text of 5xx errors.
+// The default is true in gin release mode, the mode is checked on every error.
+func ProblemWithHideInternalError(hide bool) ProblemOption {
+	return func(h *problemHandler) {
+		h.hideInternal = &hide
+	}
+}
+
+// ProblemWithTraceHeaders sets the request headers the trace id is read from,
+// the default are X-Request-Id and X-Trace-Id.
+func ProblemWithTraceHeaders(headers ...string) ProblemOption {
+	return func(h *problemHandler) {
+		h.traceHeaders = headers
+	}
+}
+
+// ProblemWithCatalog sets the catalog used to localize the detail of keyed errors by Accept-Language,
+// the default is DefaultCatalog and nil disables localization.
+func ProblemWithCatalog(catalog *Catalog) ProblemOption {
+	return func(h *problemHandler) {
+		h.catalog = catalog
+	}
+}
+
+// NewProblemErrorHandler returns a GinServerErrorHandler which renders application/problem+json.
+func NewProblemErrorHandler(opts ...ProblemOption) GinServerErrorHandler {
+	h := &problemHandler{
+		traceHeaders: []string{HeaderRequestID, HeaderTraceID},
+		catalog:      DefaultCatalog,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h.handle
+}
+
+type problemHandler struct {
+	typeBaseURI string
+	// hideInternal is nil to follow the gin mode.
+	hideInternal *bool
+	traceHeaders []string
+	catalog      *Catalog
+}
+
+func (h *problemHandler) handle(c *gin.Context, service string, err error) {
+	if err == nil {
+		return
+	}
+	problem := h.newProblem(c, service, err)
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+func (h *problemHandler) newProblem(c *gin.Context, service string, err error) *Problem {
+	status := http.StatusInternalServerError
+	var code string
+	var details []ErrorDetail
+	var apiErr ApiError
+	detail := err.Error()
+	if errors.As(err, &apiErr) {
+		status = apiErr.GetStatus()
+		code = apiErr.GetKey()
+		details = apiErr.GetDetails()
+		if h.catalog != nil {
+			if msg, lang, ok := h.catalog.LocalizeRequest(c.Request, apiErr); ok {
+				detail = msg
+				c.Header("Content-Language", lang)
+			}
+		}
+	}
+	problem := &Problem{
+		Type:     problemTypeBlank,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Service:  service,
+		TraceID:  h.getTraceID(c),
+		Code:     code,
+		Details:  details,
+	}
+	if h.typeBaseURI != "" {
+		problem.Type = h.typeBaseURI + "/" + strconv.Itoa(status)
+	}
+	if h.isHideInternal() && status >= http.StatusInternalServerError {
+		problem.Detail = ""
+	}
+	return problem
+}
+
+func (h *problemHandler) isHideInternal() bool {
+	if h.hideInternal != nil {
+		return *h.hideInternal
+	}
+	return gin.Mode() == gin.ReleaseMode
+}
+
+func (h *problemHandler) getTraceID(c *gin.Context) string {
+	for _, header := range h.traceHeaders {
+		if id := c.GetHeader(header); id != "" {
+			return id
+		}
+	}
+	if id := c.Writer.Header().Get(HeaderRequestID); id != "" {
+		return id
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(b)
+	c.Header(HeaderRequestID, id)
+	return id
+}
@@ -0,0 +1,94 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemErrorHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ProblemOption
+		err     error
+		traceID string
+		want    Problem
+	}{
+		{
+			name:    "api error",
+			err:     New(http.StatusNotFound, "user not found"),
+			traceID: "trace-1",
+			want: Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound,
+				Detail: "user not found", Instance: "/v1/users", Service: "svc", TraceID: "trace-1"},
+		},
+		{
+			name:    "internal error with type uri",
+			opts:    []ProblemOption{ProblemWithTypeBaseURI("https://errors.example.com"), ProblemWithHideInternalError(false)},
+			err:     errors.New("db down"),
+			traceID: "trace-2",
+			want: Problem{Type: "https://errors.example.com/500", Title: "Internal Server Error", Status: http.StatusInternalServerError,
+				Detail: "db down", Instance: "/v1/users", Service: "svc", TraceID: "trace-2"},
+		},
+		{
+			name:    "hide internal error",
+			opts:    []ProblemOption{ProblemWithHideInternalError(true)},
+			err:     errors.New("db down"),
+			traceID: "trace-3",
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError,
+				Instance: "/v1/users", Service: "svc", TraceID: "trace-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/v1/users", nil)
+			c.Request.Header.Set(HeaderRequestID, tt.traceID)
+
+			NewProblemErrorHandler(tt.opts...)(c, "svc", tt.err)
+
+			assert.True(t, c.IsAborted())
+			assert.Equal(t, tt.want.Status, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			var got Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProblemErrorHandlerGenerateTraceID(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+
+	NewProblemErrorHandler()(c, "svc", New(http.StatusBadRequest, "bad"))
+
+	var got Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.NotEmpty(t, got.TraceID)
+	assert.Equal(t, got.TraceID, w.Header().Get(HeaderRequestID))
+}
+
+func TestProblemErrorHandlerReleaseMode(t *testing.T) {
+	mode := gin.Mode()
+	defer gin.SetMode(mode)
+	gin.SetMode(gin.DebugMode)
+	handler := NewProblemErrorHandler()
+	gin.SetMode(gin.ReleaseMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/v1/users", nil)
+	handler(c, "svc", errors.New("db down"))
+
+	var got Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, http.StatusInternalServerError, got.Status)
+	assert.Empty(t, got.Detail, "the internal error is hidden in release mode")
+}
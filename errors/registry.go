@@ -0,0 +1,66 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ErrorCode is an entry of the error code registry.
+type ErrorCode struct {
+	Key     string `json:"key"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]ApiError)
+)
+
+// Register creates an ApiError with a machine-readable key and adds it to the registry.
+// It panics if the key is empty or already registered.
+func Register(key string, status int, msg string) ApiError {
+	if key == "" {
+		panic("error key is empty")
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[key]; ok {
+		panic(fmt.Sprintf("error key [%s] already registered", key))
+	}
+	err := &myApiError{statusCode: status, key: key, msg: msg}
+	registry[key] = err
+	return err
+}
+
+// Lookup returns the registered error of key.
+func Lookup(key string) (ApiError, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	err, ok := registry[key]
+	return err, ok
+}
+
+// GetCodes returns all registered error codes sorted by key.
+func GetCodes() []ErrorCode {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	codes := make([]ErrorCode, 0, len(registry))
+	for key, err := range registry {
+		codes = append(codes, ErrorCode{Key: key, Status: err.GetStatus(), Message: err.Error()})
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Key < codes[j].Key
+	})
+	return codes
+}
+
+// ExportCodes writes the registered error codes as json, e.g. for client SDKs and docs.
+func ExportCodes(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(GetCodes())
+}
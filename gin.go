@@ -1,7 +1,9 @@
 package apitool
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -15,12 +17,74 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// MethodAny registers the handler for every method supported by gin's Any.
+const MethodAny = "ANY"
+
+var (
+	anyMethods = []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodHead, http.MethodOptions, http.MethodDelete,
+		http.MethodConnect, http.MethodTrace,
+	}
+	supportedMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodDelete:  true,
+		http.MethodConnect: true,
+		http.MethodTrace:   true,
+	}
+)
+
 type GinApiHandler struct {
 	Handler func(c *gin.Context)
-	Method  string
+	// Method is a http method or MethodAny.
+	Method string
+	// Methods registers the same handler for several methods, it is merged with Method.
+	Methods []string
 	Path    string
 	Auth    bool
 	Group   []auth.ApiPerm
+	// AuthSchemes restricts the accepted auth schemes (e.g. auth.AuthSchemeJwt), empty accepts all.
+	// The auth middleware must implement auth.GinSchemeAuthMidInter and have the named schemes.
+	AuthSchemes []string
+	// Middles run only for this handler, after the server and group middles.
+	Middles []mid.GinMiddle
+	// Doc is optional, it's used to generate the OpenAPI document.
+	Doc *ApiDoc
+}
+
+// GetMethods returns the http methods the handler should be registered for.
+// It returns an error when a method is not supported.
+func (h *GinApiHandler) GetMethods() ([]string, error) {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, m := range append([]string{h.Method}, h.Methods...) {
+		if m == "" {
+			continue
+		}
+		var expand []string
+		if m == MethodAny {
+			expand = anyMethods
+		} else if supportedMethods[m] {
+			expand = []string{m}
+		} else {
+			return nil, fmt.Errorf("path [%s]: unsupported method [%s]", h.Path, m)
+		}
+		for _, em := range expand {
+			if !seen[em] {
+				seen[em] = true
+				methods = append(methods, em)
+			}
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("path [%s]: missing method", h.Path)
+	}
+	return methods, nil
 }
 
 type GinAPI interface {
@@ -37,9 +101,16 @@ type GinApiServer interface {
 	SetPromhttp(c ...prometheus.Collector) GinApiServer
 	SetSession(sessionHeaderName string, store session.ManagerStore, expired time.Duration) GinApiServer
 	Static(relativePath, root string) GinApiServer
+	SetOpenAPI(path string, info OpenAPIInfo) GinApiServer
+	SetJWKS(provider auth.JwksProvider, maxAge time.Duration) GinApiServer
+	GetOpenAPI() (*OpenAPIDoc, error)
+	ExportOpenAPI(file string) error
 	Run(port int) error
+	// RunTLS serves https with tlsConf, it's mutual TLS when tlsConf has ClientCAFile.
+	RunTLS(port int, tlsConf *TLSConfig) error
 	errorHandler(c *gin.Context, err error)
 	GetServer(port int) *http.Server
+	GetTLSServer(port int, tlsConf *TLSConfig) (*http.Server, error)
 }
 
 type ginApiServ struct {
@@ -48,6 +119,8 @@ type ginApiServ struct {
 	authMid      auth.GinAuthMidInter
 	myErrHandler errors.GinServerErrorHandler
 	apiMids      []gin.HandlerFunc
+	handlers     []*GinApiHandler
+	openAPIInfo  OpenAPIInfo
 }
 
 func (serv *ginApiServ) SetSession(sessionHeaderName string, store session.ManagerStore, expired time.Duration) GinApiServer {
@@ -91,25 +164,104 @@ func (serv *ginApiServ) Middles(mids ...mid.GinMiddle) GinApiServer {
 func (serv *ginApiServ) AddAPIs(apis ...GinAPI) GinApiServer {
 	for _, api := range apis {
 		api.SetApiErrorHandler(serv.errorHandler)
+		var group *GinApiGroup
+		if groupAPI, ok := api.(GinGroupAPI); ok {
+			group = groupAPI.GetGroup()
+		}
 		for _, h := range api.GetAPIs() {
-			if serv.authMid != nil {
-				serv.authMid.AddAuthPath(h.Path, h.Method, h.Auth, h.Group)
+			h = group.resolve(h)
+			methods, err := h.GetMethods()
+			if err != nil {
+				panic(err)
+			}
+			handlers := make([]gin.HandlerFunc, 0, len(serv.apiMids)+len(h.Middles)+1)
+			handlers = append(handlers, serv.apiMids...)
+			for _, m := range h.Middles {
+				m.SetApiErrorHandler(serv.errorHandler)
+				handlers = append(handlers, m.Handler())
 			}
-			switch h.Method {
-			case "GET":
-				serv.Engine.GET(h.Path, append(serv.apiMids, h.Handler)...)
-			case "POST":
-				serv.Engine.POST(h.Path, append(serv.apiMids, h.Handler)...)
-			case "PUT":
-				serv.Engine.PUT(h.Path, append(serv.apiMids, h.Handler)...)
-			case "DELETE":
-				serv.Engine.DELETE(h.Path, append(serv.apiMids, h.Handler)...)
+			handlers = append(handlers, h.Handler)
+			for _, method := range methods {
+				if serv.authMid != nil {
+					serv.authMid.AddAuthPath(h.Path, method, h.Auth, h.Group)
+					serv.setAuthSchemes(h, method)
+					serv.checkPermRules(h, method)
+				}
+				serv.Engine.Handle(method, h.Path, handlers...)
 			}
+			serv.handlers = append(serv.handlers, h)
 		}
 	}
 	return serv
 }
 
+func (serv *ginApiServ) setAuthSchemes(h *GinApiHandler, method string) {
+	if len(h.AuthSchemes) == 0 {
+		return
+	}
+	schemeMid, ok := serv.authMid.(auth.GinSchemeAuthMidInter)
+	if !ok {
+		panic(fmt.Errorf("path [%s]: auth middleware doesn't support AuthSchemes", h.Path))
+	}
+	for _, name := range h.AuthSchemes {
+		if !slices.ContainsFunc(schemeMid.AuthSchemes(), func(s *auth.AuthScheme) bool {
+			return s.Name() == name
+		}) {
+			panic(fmt.Errorf("path [%s]: unknown auth scheme [%s]", h.Path, name))
+		}
+	}
+	schemeMid.SetAuthSchemes(h.Path, method, h.AuthSchemes)
+}
+
+// checkPermRules rejects the PermRules matching a route without Auth, they'd never be checked.
+func (serv *ginApiServ) checkPermRules(h *GinApiHandler, method string) {
+	if h.Auth {
+		return
+	}
+	if ruleMid, ok := serv.authMid.(auth.GinPermRuleAuthMidInter); ok && ruleMid.HasPermRule(h.Path, method) {
+		panic(fmt.Errorf("path [%s]: perm rule requires Auth", h.Path))
+	}
+}
+
+// SetOpenAPI serves the OpenAPI document of the registered apis at path.
+// An empty path only sets the document info.
+func (serv *ginApiServ) SetOpenAPI(path string, info OpenAPIInfo) GinApiServer {
+	serv.openAPIInfo = info
+	if path != "" {
+		serv.Engine.GET(path, newOpenAPIGinHandler(serv.GetOpenAPI))
+	}
+	return serv
+}
+
+func (serv *ginApiServ) GetOpenAPI() (*OpenAPIDoc, error) {
+	info := serv.openAPIInfo
+	if info.Title == "" {
+		info.Title = serv.service
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+	var authSchemes []*auth.AuthScheme
+	if schemeMid, ok := serv.authMid.(auth.GinSchemeAuthMidInter); ok {
+		authSchemes = schemeMid.AuthSchemes()
+	}
+	return NewOpenAPIDoc(info, authSchemes, serv.handlers...)
+}
+
+func (serv *ginApiServ) ExportOpenAPI(file string) error {
+	doc, err := serv.GetOpenAPI()
+	if err != nil {
+		return err
+	}
+	return doc.WriteFile(file)
+}
+
+// SetJWKS serves the public keys of provider at auth.JwksPath.
+func (serv *ginApiServ) SetJWKS(provider auth.JwksProvider, maxAge time.Duration) GinApiServer {
+	serv.Engine.GET(auth.JwksPath, auth.NewJwksGinHandler(provider, maxAge))
+	return serv
+}
+
 func (serv *ginApiServ) SetTrustedProxies(proxies []string) GinApiServer {
 	serv.Engine.ForwardedByClientIP = true
 	var err error
@@ -136,6 +288,25 @@ func (serv *ginApiServ) GetServer(port int) *http.Server {
 	}
 }
 
+func (serv *ginApiServ) RunTLS(port int, tlsConf *TLSConfig) error {
+	srv, err := serv.GetTLSServer(port, tlsConf)
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+// GetTLSServer returns a server with the loaded certificates, run it by ListenAndServeTLS("", "").
+func (serv *ginApiServ) GetTLSServer(port int, tlsConf *TLSConfig) (*http.Server, error) {
+	conf, err := tlsConf.Build()
+	if err != nil {
+		return nil, err
+	}
+	srv := serv.GetServer(port)
+	srv.TLSConfig = conf
+	return srv, nil
+}
+
 func NewGinApiServer(mode string, service string) GinApiServer {
 	gin.SetMode(mode)
 	return &ginApiServ{
@@ -0,0 +1,102 @@
+package apitool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinApiHandlerGetMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		methods []string
+		want    []string
+		err     string
+	}{
+		{name: "method", method: http.MethodGet, want: []string{http.MethodGet}},
+		{
+			name:    "multi method",
+			method:  http.MethodGet,
+			methods: []string{http.MethodPost, http.MethodGet, http.MethodPut},
+			want:    []string{http.MethodGet, http.MethodPost, http.MethodPut},
+		},
+		{
+			name:    "patch head options",
+			methods: []string{http.MethodPatch, http.MethodHead, http.MethodOptions},
+			want:    []string{http.MethodPatch, http.MethodHead, http.MethodOptions},
+		},
+		{name: "any", method: MethodAny, methods: []string{http.MethodGet}, want: anyMethods},
+		{name: "unknown method", method: "FETCH", err: "path [/users]: unsupported method [FETCH]"},
+		{name: "lower case method", methods: []string{"get"}, err: "path [/users]: unsupported method [get]"},
+		{name: "missing method", err: "path [/users]: missing method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &GinApiHandler{Method: tt.method, Methods: tt.methods, Path: "/users"}
+			methods, err := h.GetMethods()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, methods)
+		})
+	}
+}
+
+func TestGinApiServerAddAPIsMethods(t *testing.T) {
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, c.Request.Method)
+	}
+	server := NewGinApiServer(gin.TestMode, "test").
+		AddAPIs(&testApi{handlers: []*GinApiHandler{
+			{Methods: []string{http.MethodPatch, http.MethodHead, http.MethodOptions}, Path: "/users", Handler: handler},
+		}})
+	for method, code := range map[string]int{
+		http.MethodPatch:   http.StatusOK,
+		http.MethodHead:    http.StatusOK,
+		http.MethodOptions: http.StatusOK,
+		http.MethodGet:     http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/users", nil)
+		server.GetServer(0).Handler.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, method)
+	}
+
+	assert.PanicsWithError(t, "path [/users]: unsupported method [FETCH]", func() {
+		NewGinApiServer(gin.TestMode, "test").
+			AddAPIs(&testApi{handlers: []*GinApiHandler{
+				{Method: http.MethodGet, Methods: []string{"FETCH"}, Path: "/users", Handler: handler},
+			}})
+	})
+}
+
+func TestGinApiServerPermRulesRequireAuth(t *testing.T) {
+	handler := func(c *gin.Context) {}
+	newAuthMid := func() auth.GinAuthMidInter {
+		return auth.NewGinBearAuthMid(false, auth.BearAuthWithPermRules(
+			auth.PermRule{Path: "/admin/*", Perms: []auth.ApiPerm{"admin"}},
+		))
+	}
+	assert.NotPanics(t, func() {
+		NewGinApiServer(gin.TestMode, "test").
+			SetAuth(newAuthMid()).
+			AddAPIs(&testApi{handlers: []*GinApiHandler{
+				{Method: http.MethodGet, Path: "/admin/users", Handler: handler, Auth: true},
+				{Method: http.MethodGet, Path: "/public", Handler: handler},
+			}})
+	})
+	assert.PanicsWithError(t, "path [/admin/health]: perm rule requires Auth", func() {
+		NewGinApiServer(gin.TestMode, "test").
+			SetAuth(newAuthMid()).
+			AddAPIs(&testApi{handlers: []*GinApiHandler{
+				{Method: http.MethodGet, Path: "/admin/health", Handler: handler},
+			}})
+	})
+}
@@ -0,0 +1,70 @@
+package apitool
+
+import (
+	"path"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/mid"
+)
+
+// GinApiGroup mounts the handlers of an api under Prefix.
+// Middles run after the server middles and before the handler's own Middles.
+// A handler requires auth if either the group or the handler sets Auth,
+// Group is used when the handler has no permission group.
+type GinApiGroup struct {
+	Prefix  string
+	Middles []mid.GinMiddle
+	Auth    bool
+	Group   []auth.ApiPerm
+	// AuthSchemes is used when the handler has no AuthSchemes.
+	AuthSchemes []string
+}
+
+// GinGroupAPI is a GinAPI whose handlers belong to a route group.
+type GinGroupAPI interface {
+	GinAPI
+	GetGroup() *GinApiGroup
+}
+
+// WithGroup mounts api under group without changing the api.
+func WithGroup(api GinAPI, group *GinApiGroup) GinGroupAPI {
+	return &groupAPI{GinAPI: api, group: group}
+}
+
+type groupAPI struct {
+	GinAPI
+	group *GinApiGroup
+}
+
+func (g *groupAPI) GetGroup() *GinApiGroup {
+	return g.group
+}
+
+// resolve returns a copy of h with the group prefix, auth and permission defaults applied.
+func (group *GinApiGroup) resolve(h *GinApiHandler) *GinApiHandler {
+	if group == nil {
+		return h
+	}
+	resolved := *h
+	resolved.Path = joinPaths(group.Prefix, h.Path)
+	resolved.Auth = group.Auth || h.Auth
+	if len(h.Group) == 0 {
+		resolved.Group = group.Group
+	}
+	if len(h.AuthSchemes) == 0 {
+		resolved.AuthSchemes = group.AuthSchemes
+	}
+	resolved.Middles = append(append([]mid.GinMiddle{}, group.Middles...), h.Middles...)
+	return &resolved
+}
+
+func joinPaths(prefix, relative string) string {
+	if relative == "" {
+		return prefix
+	}
+	final := path.Join(prefix, relative)
+	if relative[len(relative)-1] == '/' && final[len(final)-1] != '/' {
+		return final + "/"
+	}
+	return final
+}
@@ -0,0 +1,115 @@
+package apitool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/94peter/api-toolkit/mid"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinApiGroup(t *testing.T) {
+	var order []string
+	newMid := func(name string) mid.GinMiddle {
+		return mid.NewGinMiddle(func(c *gin.Context) {
+			order = append(order, name)
+			c.Next()
+		})
+	}
+	handler := func(c *gin.Context) {
+		order = append(order, "handler")
+		c.String(http.StatusOK, c.FullPath())
+	}
+	authMid := auth.NewGinBearAuthMid(false)
+	api := WithGroup(&testApi{handlers: []*GinApiHandler{
+		{Method: http.MethodGet, Path: "/users", Handler: handler, Middles: []mid.GinMiddle{newMid("handler-mid")}},
+		{Method: http.MethodGet, Path: "/", Handler: handler},
+	}}, &GinApiGroup{
+		Prefix:  "/admin",
+		Middles: []mid.GinMiddle{newMid("group-mid")},
+		Auth:    true,
+		Group:   []auth.ApiPerm{"admin"},
+	})
+	server := NewGinApiServer(gin.TestMode, "test").
+		SetServerErrorHandler(func(c *gin.Context, service string, err error) {
+			c.AbortWithStatus(err.(errors.ApiError).GetStatus())
+		}).
+		SetAuth(authMid).
+		Middles(newMid("server-mid")).
+		AddAPIs(api, &testApi{handlers: []*GinApiHandler{
+			{Method: http.MethodGet, Path: "/public", Handler: handler},
+		}})
+
+	assert.True(t, authMid.IsAuth("/admin/users", http.MethodGet))
+	assert.True(t, authMid.IsAuth("/admin/", http.MethodGet))
+	assert.False(t, authMid.IsAuth("/public", http.MethodGet))
+	assert.False(t, authMid.HasPerm("/admin/users", http.MethodGet, []string{"user"}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/admin/users", nil)
+	server.GetServer(0).Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/admin/users", w.Body.String())
+	assert.Equal(t, []string{"server-mid", "group-mid", "handler-mid", "handler"}, order)
+
+	doc, err := server.GetOpenAPI()
+	assert.NoError(t, err)
+	assert.Contains(t, doc.Paths, "/admin/users")
+	assert.Equal(t, []string{"admin"}, doc.Paths["/admin/users"]["get"].Security[0]["bearerAuth"])
+}
+
+func TestGinApiGroupAuthSchemes(t *testing.T) {
+	authMid := auth.NewGinMultiAuthMid(false, []*auth.AuthScheme{
+		auth.NewBearerAuthScheme(),
+		auth.NewSessionAuthScheme("sid", func(c *gin.Context, sid string) (auth.ReqUser, error) {
+			return auth.NewReqUser("", sid, "web", "web", nil, ""), nil
+		}),
+	})
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, auth.GetAuthScheme(auth.GetReqUserFromGin(c)))
+	}
+	authMid.SetApiErrorHandler(func(c *gin.Context, err error) {
+		c.AbortWithStatus(err.(errors.ApiError).GetStatus())
+	})
+	NewGinApiServer(gin.TestMode, "test").
+		SetAuth(authMid).
+		AddAPIs(WithGroup(&testApi{handlers: []*GinApiHandler{
+			{Method: http.MethodGet, Path: "/users", Handler: handler},
+			{Method: http.MethodGet, Path: "/me", Handler: handler, AuthSchemes: []string{auth.AuthSchemeSession}},
+		}}, &GinApiGroup{
+			Prefix:      "/admin",
+			Auth:        true,
+			AuthSchemes: []string{auth.AuthSchemeBearer},
+		}))
+
+	r := gin.New()
+	r.Use(authMid.Handler())
+	r.GET("/admin/users", handler)
+	r.GET("/admin/me", handler)
+	for path, code := range map[string]int{"/admin/users": http.StatusUnauthorized, "/admin/me": http.StatusOK} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+		r.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, path)
+	}
+
+	assert.Panics(t, func() {
+		NewGinApiServer(gin.TestMode, "test").
+			SetAuth(struct{ auth.GinAuthMidInter }{auth.NewGinBearAuthMid(false)}).
+			AddAPIs(&testApi{handlers: []*GinApiHandler{
+				{Method: http.MethodGet, Path: "/me", Handler: handler, Auth: true, AuthSchemes: []string{auth.AuthSchemeSession}},
+			}})
+	})
+	assert.PanicsWithError(t, "path [/me]: unknown auth scheme [sesion]", func() {
+		NewGinApiServer(gin.TestMode, "test").
+			SetAuth(authMid).
+			AddAPIs(&testApi{handlers: []*GinApiHandler{
+				{Method: http.MethodGet, Path: "/me", Handler: handler, Auth: true, AuthSchemes: []string{"sesion"}},
+			}})
+	})
+}
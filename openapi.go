@@ -0,0 +1,492 @@
+package apitool
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const openAPIVersion = "3.1.0"
+
+// ApiDoc is the optional metadata of GinApiHandler used by the OpenAPI generator.
+// Request and Response accept a value or a nil pointer of the type, e.g. (*CreateUserReq)(nil).
+type ApiDoc struct {
+	OperationID    string
+	Summary        string
+	Description    string
+	Tags           []string
+	Deprecated     bool
+	Request        any
+	Response       any
+	ResponseStatus int
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Permissions []string                    `json:"x-permissions,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// NewOpenAPIDoc builds an OpenAPI 3.1 document from the registered handlers.
+// authSchemes are the schemes of the auth middleware (see auth.GinSchemeAuthMidInter),
+// the routes are documented as bearer when it's empty.
+func NewOpenAPIDoc(info OpenAPIInfo, authSchemes []*auth.AuthScheme, handlers ...*GinApiHandler) (*OpenAPIDoc, error) {
+	doc := &OpenAPIDoc{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+	builder := &schemaBuilder{
+		schemas:         make(map[string]*OpenAPISchema),
+		schemaNames:     make(map[reflect.Type]string),
+		authSchemes:     authSchemes,
+		securitySchemes: make(map[string]*OpenAPISecurityScheme),
+	}
+	for _, h := range handlers {
+		methods, err := h.GetMethods()
+		if err != nil {
+			return nil, err
+		}
+		path, pathParams := toOpenAPIPath(h.Path)
+		for _, method := range methods {
+			if method == http.MethodConnect {
+				continue
+			}
+			op := builder.newOperation(h, method, pathParams, len(methods) > 1)
+			if _, ok := doc.Paths[path]; !ok {
+				doc.Paths[path] = make(map[string]*OpenAPIOperation)
+			}
+			doc.Paths[path][strings.ToLower(method)] = op
+		}
+	}
+	if len(builder.schemas) > 0 || len(builder.securitySchemes) > 0 {
+		doc.Components = &OpenAPIComponents{}
+		if len(builder.schemas) > 0 {
+			doc.Components.Schemas = builder.schemas
+		}
+		if len(builder.securitySchemes) > 0 {
+			doc.Components.SecuritySchemes = builder.securitySchemes
+		}
+	}
+	return doc, nil
+}
+
+// WriteFile writes the document as indented json, the output is stable for diffing.
+func (doc *OpenAPIDoc) WriteFile(file string) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+var (
+	ginPathParamReg    = regexp.MustCompile(`[:*]([^/]+)`)
+	operationIDCleaner = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+func toOpenAPIPath(path string) (string, []string) {
+	var params []string
+	for _, m := range ginPathParamReg.FindAllStringSubmatch(path, -1) {
+		params = append(params, m[1])
+	}
+	return ginPathParamReg.ReplaceAllString(path, "{$1}"), params
+}
+
+func hasRequestBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// newOperation suffixes the operationId with the method when h has multiMethod, so the ids are unique.
+func (b *schemaBuilder) newOperation(h *GinApiHandler, method string, pathParams []string, multiMethod bool) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		Responses: make(map[string]*OpenAPIResponse),
+	}
+	doc := h.Doc
+	if doc == nil {
+		doc = &ApiDoc{}
+	}
+	op.OperationID = doc.OperationID
+	if op.OperationID == "" {
+		op.OperationID = strings.ToLower(method) + "_" +
+			strings.Trim(operationIDCleaner.ReplaceAllString(h.Path, "_"), "_")
+	} else if multiMethod {
+		op.OperationID += "_" + strings.ToLower(method)
+	}
+	op.Summary = doc.Summary
+	op.Description = doc.Description
+	op.Tags = doc.Tags
+	op.Deprecated = doc.Deprecated
+
+	declared := make(map[string]bool)
+	if doc.Request != nil {
+		params, body := b.requestParams(reflect.TypeOf(doc.Request))
+		for _, p := range params {
+			if p.In == "path" {
+				declared[p.Name] = true
+			}
+		}
+		op.Parameters = append(op.Parameters, params...)
+		if body != nil && hasRequestBody(method) {
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content:  map[string]*OpenAPIMediaType{"application/json": {Schema: body}},
+			}
+		}
+	}
+	for _, p := range pathParams {
+		if !declared[p] {
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{
+				Name: p, In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"},
+			})
+		}
+	}
+
+	status := doc.ResponseStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := &OpenAPIResponse{Description: http.StatusText(status)}
+	if doc.Response != nil {
+		resp.Content = map[string]*OpenAPIMediaType{
+			"application/json": {Schema: b.schemaOf(reflect.TypeOf(doc.Response))},
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+
+	if h.Auth {
+		scopes := make([]string, len(h.Group))
+		for i, g := range h.Group {
+			scopes[i] = string(g)
+		}
+		for _, name := range b.securityOf(h) {
+			op.Security = append(op.Security, map[string][]string{name: scopes})
+		}
+		op.Permissions = scopes
+		op.Responses[strconv.Itoa(http.StatusUnauthorized)] = &OpenAPIResponse{
+			Description: http.StatusText(http.StatusUnauthorized)}
+		if len(scopes) > 0 {
+			op.Responses[strconv.Itoa(http.StatusForbidden)] = &OpenAPIResponse{
+				Description: http.StatusText(http.StatusForbidden)}
+		}
+	}
+	return op
+}
+
+type schemaBuilder struct {
+	schemas map[string]*OpenAPISchema
+	// schemaNames are the component names of the struct types.
+	schemaNames     map[reflect.Type]string
+	authSchemes     []*auth.AuthScheme
+	securitySchemes map[string]*OpenAPISecurityScheme
+}
+
+// securityOf registers the security schemes accepted by h and returns their names,
+// a route without AuthSchemes accepts every scheme of the middleware.
+func (b *schemaBuilder) securityOf(h *GinApiHandler) []string {
+	var names []string
+	add := func(scheme, cookie string) {
+		name, ss := openAPISecurityScheme(scheme, cookie)
+		if _, ok := b.securitySchemes[name]; !ok {
+			b.securitySchemes[name] = ss
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(b.authSchemes) == 0 {
+		for _, s := range h.AuthSchemes {
+			add(s, "")
+		}
+		if len(names) == 0 {
+			add(auth.AuthSchemeBearer, "")
+		}
+		return names
+	}
+	for _, s := range b.authSchemes {
+		if len(h.AuthSchemes) == 0 || slices.Contains(h.AuthSchemes, s.Name()) {
+			add(s.Name(), s.Cookie())
+		}
+	}
+	return names
+}
+
+// openAPISecurityScheme maps an auth scheme to its component name and security scheme.
+func openAPISecurityScheme(scheme, cookie string) (string, *OpenAPISecurityScheme) {
+	switch scheme {
+	case auth.AuthSchemeApiKey:
+		return "apiKeyAuth", &OpenAPISecurityScheme{Type: "apiKey", In: "header", Name: auth.ApiKeyHeaderKey}
+	case auth.AuthSchemeHmac:
+		return "hmacAuth", &OpenAPISecurityScheme{Type: "http", Scheme: auth.HmacScheme,
+			Description: "requests signed by auth.HmacSigner"}
+	case auth.AuthSchemeCert:
+		return "mtlsAuth", &OpenAPISecurityScheme{Type: "mutualTLS"}
+	case auth.AuthSchemeSession:
+		return "sessionAuth", &OpenAPISecurityScheme{Type: "apiKey", In: "cookie", Name: cookie}
+	case auth.AuthSchemeIntrospection:
+		return "introspectionAuth", &OpenAPISecurityScheme{Type: "http", Scheme: "bearer",
+			Description: "opaque token checked by token introspection"}
+	}
+	return "bearerAuth", &OpenAPISecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+}
+
+// requestParams splits a request struct into parameters (uri, form, header tags) and body schema.
+func (b *schemaBuilder) requestParams(t reflect.Type) ([]*OpenAPIParameter, *OpenAPISchema) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil, b.schemaOf(t)
+	}
+	var params []*OpenAPIParameter
+	hasBody := false
+	for _, f := range structFields(t) {
+		in, name := paramLocation(f)
+		if in == "" {
+			if _, ok := jsonFieldName(f); ok {
+				hasBody = true
+			}
+			continue
+		}
+		params = append(params, &OpenAPIParameter{
+			Name:     name,
+			In:       in,
+			Required: in == "path" || isRequiredField(f),
+			Schema:   b.schemaOf(f.Type),
+		})
+	}
+	if !hasBody {
+		return params, nil
+	}
+	return params, b.schemaOf(t)
+}
+
+func paramLocation(f reflect.StructField) (in string, name string) {
+	for _, tag := range []struct{ key, in string }{
+		{"uri", "path"}, {"form", "query"}, {"header", "header"},
+	} {
+		if v, ok := f.Tag.Lookup(tag.key); ok {
+			name = strings.Split(v, ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			return tag.in, name
+		}
+	}
+	return "", ""
+}
+
+func isRequiredField(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("json")
+	if !ok {
+		return f.Name, true
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// structFields returns the exported fields of t, embedded structs are flattened.
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if _, tagged := f.Tag.Lookup("json"); !tagged && ft.Kind() == reflect.Struct {
+				fields = append(fields, structFields(ft)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	schemaNameCleaner = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name, ok := b.schemaNames[t]
+		if !ok {
+			name = b.schemaName(t)
+			// reserve the name first to stop recursive types
+			b.schemaNames[t] = name
+			b.schemas[name] = &OpenAPISchema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	}
+	return &OpenAPISchema{}
+}
+
+// schemaName is the type name, it's qualified with the package path when
+// another type of the same name is registered.
+func (b *schemaBuilder) schemaName(t reflect.Type) string {
+	name := schemaNameCleaner.ReplaceAllString(t.Name(), "_")
+	if _, taken := b.schemas[name]; taken {
+		name = schemaNameCleaner.ReplaceAllString(t.PkgPath()+"."+t.Name(), "_")
+	}
+	return name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	for _, f := range structFields(t) {
+		if in, _ := paramLocation(f); in != "" {
+			if _, tagged := f.Tag.Lookup("json"); !tagged {
+				continue
+			}
+		}
+		name, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		schema.Properties[name] = b.schemaOf(f.Type)
+		if isRequiredField(f) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+func newOpenAPIGinHandler(getDoc func() (*OpenAPIDoc, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc, err := getDoc()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	}
+}
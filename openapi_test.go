@@ -0,0 +1,174 @@
+package apitool
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/94peter/api-toolkit/auth"
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type testApi struct {
+	errors.CommonApiErrorHandler
+	handlers []*GinApiHandler
+}
+
+func (a *testApi) GetAPIs() []*GinApiHandler {
+	return a.handlers
+}
+
+type testUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name" binding:"required"`
+}
+
+type testUpdateUserReq struct {
+	ID      string `uri:"id"`
+	DryRun  bool   `form:"dry_run"`
+	TraceID string `header:"X-Trace-Id"`
+	Name    string `json:"name" binding:"required"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	noop := func(c *gin.Context) {}
+	server := NewGinApiServer(gin.TestMode, "test").
+		AddAPIs(&testApi{handlers: []*GinApiHandler{
+			{Method: http.MethodGet, Path: "/v1/users", Handler: noop,
+				Doc: &ApiDoc{Summary: "list users", Tags: []string{"user"}, Response: []testUser{}}},
+			{Method: http.MethodPatch, Path: "/v1/users/:id", Handler: noop, Auth: true,
+				Group: []auth.ApiPerm{"admin"},
+				Doc:   &ApiDoc{Request: (*testUpdateUserReq)(nil), Response: (*testUser)(nil)}},
+			{Method: http.MethodDelete, Path: "/v1/users/:id", Handler: noop, Auth: true},
+		}}).
+		SetOpenAPI("/openapi.json", OpenAPIInfo{Title: "test api", Version: "0.1.0"})
+
+	doc, err := server.GetOpenAPI()
+	assert.NoError(t, err)
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Equal(t, "list users", doc.Paths["/v1/users"]["get"].Summary)
+	assert.Equal(t, "array", doc.Paths["/v1/users"]["get"].Responses["200"].Content["application/json"].Schema.Type)
+
+	patch := doc.Paths["/v1/users/{id}"]["patch"]
+	assert.Len(t, patch.Parameters, 3)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {"admin"}}}, patch.Security)
+	assert.Contains(t, patch.Responses, "403")
+	body := patch.RequestBody.Content["application/json"].Schema
+	assert.Equal(t, "#/components/schemas/testUpdateUserReq", body.Ref)
+	assert.Equal(t, []string{"name"}, doc.Components.Schemas["testUpdateUserReq"].Required)
+	assert.Len(t, doc.Components.Schemas["testUpdateUserReq"].Properties, 1)
+
+	del := doc.Paths["/v1/users/{id}"]["delete"]
+	assert.Equal(t, "id", del.Parameters[0].Name)
+	assert.NotContains(t, del.Responses, "403")
+	assert.Contains(t, doc.Components.SecuritySchemes, "bearerAuth")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	server.GetServer(0).Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var served OpenAPIDoc
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, "test api", served.Info.Title)
+
+	file := filepath.Join(t.TempDir(), "openapi.json")
+	assert.NoError(t, server.ExportOpenAPI(file))
+	exported, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	again := filepath.Join(t.TempDir(), "openapi.json")
+	assert.NoError(t, server.ExportOpenAPI(again))
+	exportedAgain, _ := os.ReadFile(again)
+	assert.Equal(t, string(exported), string(exportedAgain))
+}
+
+// Token has the name of auth.Token, the schemas must not overwrite each other.
+type Token struct {
+	Value   string `json:"value"`
+	Counter uint32 `json:"counter"`
+	Size    int    `json:"size"`
+}
+
+func TestOpenAPISchemaNameCollision(t *testing.T) {
+	noop := func(c *gin.Context) {}
+	doc, err := NewOpenAPIDoc(OpenAPIInfo{Title: "test", Version: "1"}, nil,
+		&GinApiHandler{Method: http.MethodGet, Path: "/token", Handler: noop,
+			Doc: &ApiDoc{Response: (*Token)(nil)}},
+		&GinApiHandler{Method: http.MethodPost, Path: "/login", Handler: noop,
+			Doc: &ApiDoc{Response: (*auth.Token)(nil)}},
+		&GinApiHandler{Method: http.MethodPut, Path: "/token", Handler: noop,
+			Doc: &ApiDoc{Response: Token{}}},
+	)
+	assert.NoError(t, err)
+	assert.Len(t, doc.Components.Schemas, 2)
+	assert.Equal(t, "#/components/schemas/Token",
+		doc.Paths["/token"]["get"].Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/Token",
+		doc.Paths["/token"]["put"].Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/github.com_94peter_api-toolkit_auth.Token",
+		doc.Paths["/login"]["post"].Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas["Token"].Properties, "value")
+	assert.Contains(t, doc.Components.Schemas["github.com_94peter_api-toolkit_auth.Token"].Properties, "AccessToken")
+	assert.Equal(t, "int64", doc.Components.Schemas["Token"].Properties["counter"].Format)
+	assert.Equal(t, "int64", doc.Components.Schemas["Token"].Properties["size"].Format)
+}
+
+func TestOpenAPIOperationID(t *testing.T) {
+	noop := func(c *gin.Context) {}
+	doc, err := NewOpenAPIDoc(OpenAPIInfo{Title: "test", Version: "1"}, nil,
+		&GinApiHandler{Methods: []string{http.MethodGet, http.MethodPost}, Path: "/users", Handler: noop,
+			Doc: &ApiDoc{OperationID: "users"}},
+		&GinApiHandler{Method: MethodAny, Path: "/any", Handler: noop},
+		&GinApiHandler{Method: http.MethodGet, Path: "/me", Handler: noop, Doc: &ApiDoc{OperationID: "me"}},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "users_get", doc.Paths["/users"]["get"].OperationID)
+	assert.Equal(t, "users_post", doc.Paths["/users"]["post"].OperationID)
+	assert.Equal(t, "me", doc.Paths["/me"]["get"].OperationID)
+	ids := make(map[string]bool)
+	for _, op := range doc.Paths["/any"] {
+		assert.False(t, ids[op.OperationID], op.OperationID)
+		ids[op.OperationID] = true
+	}
+	assert.Len(t, ids, len(anyMethods)-1)
+}
+
+func TestOpenAPISecuritySchemes(t *testing.T) {
+	noop := func(c *gin.Context) {}
+	authMid := auth.NewGinMultiAuthMid(false, []*auth.AuthScheme{
+		auth.NewBearerAuthScheme(),
+		auth.NewApiKeyAuthScheme(nil),
+		auth.NewHmacAuthScheme(auth.HmacAuthConf{}),
+		auth.NewCertAuthScheme(nil),
+		auth.NewSessionAuthScheme("sid", nil),
+	})
+	server := NewGinApiServer(gin.TestMode, "test").
+		SetAuth(authMid).
+		AddAPIs(&testApi{handlers: []*GinApiHandler{
+			{Method: http.MethodGet, Path: "/machine", Handler: noop, Auth: true,
+				Group: []auth.ApiPerm{"admin"}, AuthSchemes: []string{auth.AuthSchemeApiKey, auth.AuthSchemeHmac}},
+			{Method: http.MethodGet, Path: "/me", Handler: noop, Auth: true},
+			{Method: http.MethodGet, Path: "/public", Handler: noop},
+		}})
+
+	doc, err := server.GetOpenAPI()
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string][]string{{"apiKeyAuth": {"admin"}}, {"hmacAuth": {"admin"}}},
+		doc.Paths["/machine"]["get"].Security)
+	assert.Equal(t, []map[string][]string{
+		{"bearerAuth": {}}, {"apiKeyAuth": {}}, {"hmacAuth": {}}, {"mtlsAuth": {}}, {"sessionAuth": {}},
+	}, doc.Paths["/me"]["get"].Security)
+	assert.Empty(t, doc.Paths["/public"]["get"].Security)
+
+	schemes := doc.Components.SecuritySchemes
+	assert.Len(t, schemes, 5)
+	assert.Equal(t, &OpenAPISecurityScheme{Type: "apiKey", In: "header", Name: auth.ApiKeyHeaderKey}, schemes["apiKeyAuth"])
+	assert.Equal(t, &OpenAPISecurityScheme{Type: "apiKey", In: "cookie", Name: "sid"}, schemes["sessionAuth"])
+	assert.Equal(t, "mutualTLS", schemes["mtlsAuth"].Type)
+	assert.Equal(t, auth.HmacScheme, schemes["hmacAuth"].Scheme)
+	assert.Equal(t, "bearer", schemes["bearerAuth"].Scheme)
+}
@@ -2,6 +2,7 @@ package apitool
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
 	"reflect"
 	"strings"
@@ -15,7 +16,8 @@ func ParserDataRequest(req *http.Request, data interface{}) error {
 	if kindOfJ != reflect.Ptr {
 		return errors.New("data is not pointer")
 	}
-	switch req.Header.Get("Content-Type") {
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch contentType {
 	case "application/json":
 		err := json.NewDecoder(req.Body).Decode(data)
 		if err != nil {
@@ -0,0 +1,85 @@
+package apitool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig is the server TLS, mutual TLS is enabled by ClientCAFile.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" (default) or "1.3".
+	MinVersion string
+	// CipherSuites are the names of the allowed TLS 1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	// Only the secure suites of crypto/tls are allowed, empty uses the Go defaults.
+	CipherSuites []string
+	// ClientCAFile is the pem CA bundle verifying the client certificates.
+	ClientCAFile string
+	// ClientAuthOptional accepts the requests without a client certificate,
+	// the auth middleware decides which routes require it.
+	ClientAuthOptional bool
+}
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Build loads the certificates and returns the tls.Config of the server.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls min version [%s]", c.MinVersion)
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion:   minVersion,
+		Certificates: []tls.Certificate{cert},
+	}
+	if len(c.CipherSuites) > 0 {
+		conf.CipherSuites, err = getCipherSuites(c.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.ClientCAFile != "" {
+		data, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate in client ca file [%s]", c.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.ClientAuthOptional {
+			conf.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return conf, nil
+}
+
+func getCipherSuites(names []string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		secure[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := secure[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite [%s]", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,70 @@
+package apitool
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self-signed certificate and key, the certificate is also a CA bundle.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return
+}
+
+func TestTLSConfigBuild(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+
+	conf, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile}).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+	assert.Len(t, conf.Certificates, 1)
+	assert.Equal(t, tls.NoClientCert, conf.ClientAuth)
+
+	conf, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, ClientCAFile: certFile}).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), conf.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, conf.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	assert.NotNil(t, conf.ClientCAs)
+
+	conf, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuthOptional: true}).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, conf.ClientAuth)
+
+	_, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"}).Build()
+	assert.Error(t, err)
+	_, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}).Build()
+	assert.Error(t, err)
+	_, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}).Build()
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package apitool
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// TypedHandlerFunc is a handler with a bound request and an encoded response.
+type TypedHandlerFunc[Req any, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// ResponseStatusCoder can be implemented by the response to change the http status, default is 200.
+type ResponseStatusCoder interface {
+	ResponseStatus() int
+}
+
+type ginCtxKey struct{}
+
+// GetGinContext returns the gin context of a typed handler's ctx.
+func GetGinContext(ctx context.Context) *gin.Context {
+	c, _ := ctx.Value(ginCtxKey{}).(*gin.Context)
+	return c
+}
+
+var negotiateOffered = []string{binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2, binding.MIMEYAML}
+
+// TypedHandler binds path(uri tag), query(form tag), header(header tag) and body into Req,
+// calls fn and encodes the response with content negotiation.
+// Errors are routed to the api's GinApiErrorHandler, which is resolved on every request.
+func TypedHandler[Req any, Resp any](errHandler *errors.CommonApiErrorHandler, fn TypedHandlerFunc[Req, Resp]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req Req
+		if err := bindTypedRequest(c, &req); err != nil {
+			errHandler.GinApiErrorHandler(c, newBindError(err))
+			return
+		}
+		ctx := context.WithValue(c.Request.Context(), ginCtxKey{}, c)
+		resp, err := fn(ctx, req)
+		if err != nil {
+			errHandler.GinApiErrorHandler(c, err)
+			return
+		}
+		if c.Writer.Written() {
+			return
+		}
+		rv := reflect.ValueOf(resp)
+		if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		status := http.StatusOK
+		if s, ok := any(resp).(ResponseStatusCoder); ok {
+			status = s.ResponseStatus()
+		}
+		c.Negotiate(status, gin.Negotiate{Offered: negotiateOffered, Data: resp})
+	}
+}
+
+// NewTypedApiHandler creates a GinApiHandler of a typed handler, the Doc carries the Req and Resp types.
+func NewTypedApiHandler[Req any, Resp any](
+	method, path string, errHandler *errors.CommonApiErrorHandler, fn TypedHandlerFunc[Req, Resp],
+) *GinApiHandler {
+	return &GinApiHandler{
+		Method:  method,
+		Path:    path,
+		Handler: TypedHandler(errHandler, fn),
+		Doc: &ApiDoc{
+			Request:  (*Req)(nil),
+			Response: (*Resp)(nil),
+		},
+	}
+}
+
+var errUnsupportedMediaType = errors.New(http.StatusUnsupportedMediaType, "unsupported media type")
+
+// bindMediaTypes are the body content types supported by ParserDataRequest.
+var bindMediaTypes = []string{binding.MIMEJSON, binding.MIMEPOSTForm}
+
+func bindTypedRequest(c *gin.Context, req any) error {
+	// allocate the pointer Req types, so req is bound as a pointer to the struct.
+	v := reflect.ValueOf(req).Elem()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	req = v.Addr().Interface()
+	t := v.Type()
+	if c.Request.Body != nil && c.Request.ContentLength != 0 && hasRequestBody(c.Request.Method) {
+		mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+		if !slices.Contains(bindMediaTypes, mediaType) {
+			return errUnsupportedMediaType
+		}
+		if err := ParserDataRequest(c.Request, req); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	fields := structFields(t)
+	if hasFieldTag(fields, "uri") {
+		params := make(map[string][]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = []string{p.Value}
+		}
+		if err := binding.MapFormWithTag(req, params, "uri"); err != nil {
+			return err
+		}
+	}
+	if hasFieldTag(fields, "form") {
+		// only the tagged names are mapped, gin falls back to the field name of the
+		// untagged fields, so the query could override the uri and body values.
+		query := c.Request.URL.Query()
+		values := make(map[string][]string)
+		for _, f := range fields {
+			if in, name := paramLocation(f); in == "query" {
+				if v, ok := query[name]; ok {
+					values[name] = v
+				}
+			}
+		}
+		if err := binding.MapFormWithTag(req, values, "form"); err != nil {
+			return err
+		}
+	}
+	if hasFieldTag(fields, "header") {
+		headers := make(map[string][]string)
+		for _, f := range fields {
+			if in, name := paramLocation(f); in == "header" {
+				if values := c.Request.Header.Values(name); len(values) > 0 {
+					headers[name] = values
+				}
+			}
+		}
+		if err := binding.MapFormWithTag(req, headers, "header"); err != nil {
+			return err
+		}
+	}
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(req)
+}
+
+// newBindError converts validation failures to error details.
+func newBindError(err error) errors.ApiError {
+	if apiErr, ok := err.(errors.ApiError); ok {
+		return apiErr
+	}
+	apiErr := errors.PkgError(http.StatusBadRequest, err)
+	var validationErrs validator.ValidationErrors
+	if !stderrors.As(err, &validationErrs) {
+		return apiErr
+	}
+	details := make([]errors.ErrorDetail, len(validationErrs))
+	for i, fe := range validationErrs {
+		details[i] = errors.ErrorDetail{Field: fe.Field(), Key: fe.Tag(), Message: fe.Error()}
+	}
+	return errors.WithDetails(apiErr, details...)
+}
+
+func hasFieldTag(fields []reflect.StructField, tag string) bool {
+	for _, f := range fields {
+		if _, ok := f.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+	return false
+}
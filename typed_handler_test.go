@@ -0,0 +1,150 @@
+package apitool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/94peter/api-toolkit/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type typedTestApi struct {
+	errors.CommonApiErrorHandler
+}
+
+type typedUpdateReq struct {
+	ID      string `uri:"id" binding:"required"`
+	Force   bool   `form:"force"`
+	TraceID string `header:"X-Trace-Id"`
+	Name    string `json:"name" binding:"required"`
+}
+
+type typedUpdateResp struct {
+	ID      string `json:"id" xml:"id"`
+	Name    string `json:"name" xml:"name"`
+	Force   bool   `json:"force" xml:"force"`
+	TraceID string `json:"traceId" xml:"traceId"`
+}
+
+func (a *typedTestApi) GetAPIs() []*GinApiHandler {
+	return []*GinApiHandler{
+		NewTypedApiHandler(http.MethodPut, "/v1/users/:id", &a.CommonApiErrorHandler, a.update),
+		NewTypedApiHandler(http.MethodPut, "/v2/users/:id", &a.CommonApiErrorHandler, a.updatePtr),
+	}
+}
+
+func (a *typedTestApi) update(ctx context.Context, req typedUpdateReq) (*typedUpdateResp, error) {
+	if GetGinContext(ctx) == nil {
+		return nil, errors.New(http.StatusInternalServerError, "missing gin context")
+	}
+	if req.Name == "conflict" {
+		return nil, errors.New(http.StatusConflict, "conflict")
+	}
+	return &typedUpdateResp{ID: req.ID, Name: req.Name, Force: req.Force, TraceID: req.TraceID}, nil
+}
+
+func (a *typedTestApi) updatePtr(ctx context.Context, req *typedUpdateReq) (*typedUpdateResp, error) {
+	return a.update(ctx, *req)
+}
+
+func TestTypedHandler(t *testing.T) {
+	server := NewGinApiServer(gin.TestMode, "test").
+		SetServerErrorHandler(func(c *gin.Context, service string, err error) {
+			status := http.StatusInternalServerError
+			if apiErr, ok := err.(errors.ApiError); ok {
+				status = apiErr.GetStatus()
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		}).
+		AddAPIs(&typedTestApi{})
+	handler := server.GetServer(0).Handler
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		contentType string
+		accept      string
+		statusCode  int
+		respBody    string
+	}{
+		{
+			name:       "json",
+			body:       `{"name":"peter"}`,
+			statusCode: http.StatusOK,
+			respBody:   `{"id":"u1","name":"peter","force":true,"traceId":"t1"}`,
+		},
+		{
+			name:       "xml",
+			body:       `{"name":"peter"}`,
+			accept:     "application/xml",
+			statusCode: http.StatusOK,
+			respBody:   "<typedUpdateResp><id>u1</id><name>peter</name><force>true</force><traceId>t1</traceId></typedUpdateResp>",
+		},
+		{name: "validate fail", body: `{}`, statusCode: http.StatusBadRequest},
+		{name: "handler error", body: `{"name":"conflict"}`, statusCode: http.StatusConflict},
+		{
+			name:        "form",
+			body:        "name=peter",
+			contentType: "application/x-www-form-urlencoded",
+			statusCode:  http.StatusOK,
+			respBody:    `{"id":"u1","name":"peter","force":true,"traceId":"t1"}`,
+		},
+		{
+			name:        "pointer req form",
+			path:        "/v2/users/u1?force=true",
+			body:        "name=peter",
+			contentType: "application/x-www-form-urlencoded",
+			statusCode:  http.StatusOK,
+			respBody:    `{"id":"u1","name":"peter","force":true,"traceId":"t1"}`,
+		},
+		{
+			name:       "pointer req json",
+			path:       "/v2/users/u1?force=true",
+			body:       `{"name":"peter"}`,
+			statusCode: http.StatusOK,
+			respBody:   `{"id":"u1","name":"peter","force":true,"traceId":"t1"}`,
+		},
+		{
+			name:       "query doesn't override uri and body",
+			path:       "/v1/users/u1?force=true&ID=evil&Name=q",
+			body:       `{"name":"peter"}`,
+			statusCode: http.StatusOK,
+			respBody:   `{"id":"u1","name":"peter","force":true,"traceId":"t1"}`,
+		},
+		{name: "unsupported media type", body: "name: peter", contentType: "text/yaml", statusCode: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			path, contentType := tt.path, tt.contentType
+			if path == "" {
+				path = "/v1/users/u1?force=true"
+			}
+			if contentType == "" {
+				contentType = "application/json; charset=utf-8"
+			}
+			req, _ := http.NewRequest(http.MethodPut, path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("X-Trace-Id", "t1")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.respBody != "" {
+				assert.Equal(t, tt.respBody, w.Body.String())
+			}
+		})
+	}
+
+	doc, err := server.GetOpenAPI()
+	assert.NoError(t, err)
+	op := doc.Paths["/v1/users/{id}"]["put"]
+	assert.Len(t, op.Parameters, 3)
+	assert.Equal(t, "#/components/schemas/typedUpdateResp", op.Responses["200"].Content["application/json"].Schema.Ref)
+}